@@ -0,0 +1,132 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"monkey/token"
+)
+
+func TestString(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "myVar"},
+					Value: "myVar",
+				},
+				Value: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "anotherVar"},
+					Value: "anotherVar",
+				},
+			},
+		},
+	}
+
+	if program.String() != "let myVar = anotherVar;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestDump(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5},
+					Value: "x",
+				},
+				Value: &PrefixExpression{
+					Token:    token.Token{Type: token.MINUS, Literal: "-", Line: 1, Column: 9},
+					Operator: "-",
+					Right: &IntegerLiteral{
+						Token: token.Token{Type: token.INT, Literal: "5", Line: 1, Column: 10},
+						Value: 5,
+					},
+				},
+			},
+		},
+	}
+
+	expected := `Program
+  Statements:
+    LetStatement 1:1
+      Name: Identifier 1:5 Value="x"
+      Value: PrefixExpression 1:9 Operator="-"
+        Right: IntegerLiteral 1:10 Value=5
+`
+
+	if got := Dump(program); got != expected {
+		t.Errorf("Dump wrong.\nexpected=%q\ngot=     %q", expected, got)
+	}
+
+	json, err := DumpJSON(program.Statements[0].(*LetStatement).Name)
+	if err != nil {
+		t.Fatalf("DumpJSON failed: %s", err)
+	}
+
+	expectedJSON := `{
+  "column": 5,
+  "line": 1,
+  "node": "Identifier",
+  "value": "x"
+}`
+
+	if json != expectedJSON {
+		t.Errorf("DumpJSON wrong.\nexpected=%q\ngot=     %q", expectedJSON, json)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	one := &IntegerLiteral{Value: 1}
+	key := &StringLiteral{Value: "k"}
+
+	// if (x) { fn(a) { a }(1) } with no else, then {"k": [y]}
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &IfExpression{
+				Condition: ident("x"),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &CallExpression{
+						Function: &FunctionLiteral{
+							Parameters: []*Identifier{ident("a")},
+							Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("a")}}},
+						},
+						Arguments: []Expression{one},
+					}},
+				}},
+			}},
+			&ExpressionStatement{Expression: &HashLiteral{
+				Keys:  []Expression{key},
+				Pairs: map[Expression]Expression{key: &ArrayLiteral{Elements: []Expression{ident("y")}}},
+			}},
+		},
+	}
+
+	tests := []struct {
+		skip     string // the kind of node not to go into
+		expected string
+	}{
+		{"", "Program ExpressionStatement IfExpression Identifier BlockStatement ExpressionStatement CallExpression " +
+			"FunctionLiteral Identifier BlockStatement ExpressionStatement Identifier IntegerLiteral " +
+			"ExpressionStatement HashLiteral StringLiteral ArrayLiteral Identifier"},
+		{"FunctionLiteral", "Program ExpressionStatement IfExpression Identifier BlockStatement ExpressionStatement CallExpression " +
+			"FunctionLiteral IntegerLiteral ExpressionStatement HashLiteral StringLiteral ArrayLiteral Identifier"},
+		{"Program", "Program"},
+	}
+
+	for _, tt := range tests {
+		var kinds []string
+		Inspect(program, func(node Node) bool {
+			kinds = append(kinds, nodeKind(node))
+			return nodeKind(node) != tt.skip
+		})
+
+		if got := strings.Join(kinds, " "); got != tt.expected {
+			t.Errorf("skipping %q: wrong nodes.\nexpected=%q\ngot=     %q", tt.skip, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+/*
+Dump and DumpJSON show the structure of a tree, which String() hides (it
+prints the tree back out as source). both work off reflection instead of
+a method per node type, so new node types show up without extra work:
+  - fields that hold nodes (or slices of them) become children
+  - other fields (Value, Operator) become attributes of the node
+  - the Token field is only used for the node's position
+*/
+
+// Dump returns an indented, one node per line view of the tree, e.g.
+//
+//	Program
+//	  LetStatement 1:1
+//	    Name: Identifier 1:5 Value="x"
+//	    Value: IntegerLiteral 1:9 Value=5
+func Dump(node Node) string {
+	var out strings.Builder
+	dumpNode(&out, "", node, 0)
+	return out.String()
+}
+
+func dumpNode(out *strings.Builder, label string, node Node, depth int) {
+	out.WriteString(strings.Repeat("  ", depth))
+	if label != "" {
+		out.WriteString(label + ": ")
+	}
+
+	if IsNil(node) {
+		out.WriteString("<nil>\n")
+		return
+	}
+
+	v := reflect.ValueOf(node).Elem()
+	out.WriteString(nodeKind(node))
+
+	if tok := v.FieldByName("Token"); tok.IsValid() {
+		if line := tok.FieldByName("Line").Int(); line > 0 {
+			fmt.Fprintf(out, " %d:%d", line, tok.FieldByName("Column").Int())
+		}
+	}
+
+	for _, f := range attributeFields(v) {
+		fmt.Fprintf(out, " %s=%s", f.name, f.value)
+	}
+	out.WriteString("\n")
+
+	for _, c := range childFields(v) {
+		switch {
+		case c.node != nil:
+			dumpNode(out, c.name, c.node, depth+1)
+		case c.pairs != nil:
+			out.WriteString(strings.Repeat("  ", depth+1) + c.name + ":\n")
+			for _, pair := range c.pairs {
+				dumpNode(out, "Key", pair[0], depth+2)
+				dumpNode(out, "Value", pair[1], depth+2)
+			}
+		default:
+			out.WriteString(strings.Repeat("  ", depth+1) + c.name + ":\n")
+			for _, n := range c.list {
+				dumpNode(out, "", n, depth+2)
+			}
+		}
+	}
+}
+
+// DumpJSON returns the same tree as Dump as indented JSON, with every node
+// an object that has a "node" (its type) plus "line" and "column" keys
+func DumpJSON(node Node) (string, error) {
+	b, err := json.MarshalIndent(jsonNode(node), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func jsonNode(node Node) interface{} {
+	if IsNil(node) {
+		return nil
+	}
+
+	v := reflect.ValueOf(node).Elem()
+	obj := map[string]interface{}{"node": nodeKind(node)}
+
+	if tok := v.FieldByName("Token"); tok.IsValid() {
+		obj["line"] = tok.FieldByName("Line").Int()
+		obj["column"] = tok.FieldByName("Column").Int()
+	}
+
+	for _, f := range attributeFields(v) {
+		obj[jsonName(f.name)] = f.raw
+	}
+
+	for _, c := range childFields(v) {
+		switch {
+		case c.node != nil:
+			obj[jsonName(c.name)] = jsonNode(c.node)
+		case c.pairs != nil:
+			pairs := []interface{}{}
+			for _, pair := range c.pairs {
+				pairs = append(pairs, map[string]interface{}{
+					"key":   jsonNode(pair[0]),
+					"value": jsonNode(pair[1]),
+				})
+			}
+			obj[jsonName(c.name)] = pairs
+		default:
+			list := []interface{}{}
+			for _, n := range c.list {
+				list = append(list, jsonNode(n))
+			}
+			obj[jsonName(c.name)] = list
+		}
+	}
+
+	return obj
+}
+
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+type attribute struct {
+	name  string
+	value string      // formatted for Dump
+	raw   interface{} // as is, for DumpJSON
+}
+
+type child struct {
+	name  string
+	node  Node      // set for single node fields
+	list  []Node    // set for slices of nodes
+	pairs [][2]Node // set for the pairs of a HashLiteral
+}
+
+func attributeFields(v reflect.Value) []attribute {
+	attrs := []attribute{}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.Name == "Token" || !f.IsExported() || isNodeField(f.Type) {
+			continue
+		}
+
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.String:
+			attrs = append(attrs, attribute{f.Name, fmt.Sprintf("%q", fv.String()), fv.String()})
+		case reflect.Int, reflect.Int64, reflect.Bool:
+			attrs = append(attrs, attribute{f.Name, fmt.Sprintf("%v", fv.Interface()), fv.Interface()})
+		}
+	}
+
+	return attrs
+}
+
+func childFields(v reflect.Value) []child {
+	children := []child{}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() || !isNodeField(f.Type) {
+			continue
+		}
+
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.Slice:
+			// a HashLiteral's Keys are printed together with their values
+			// from Pairs instead of on their own
+			if hash, ok := v.Addr().Interface().(*HashLiteral); ok && f.Name == "Keys" {
+				pairs := [][2]Node{}
+				for _, key := range hash.Keys {
+					pairs = append(pairs, [2]Node{key, hash.Pairs[key]})
+				}
+				children = append(children, child{name: "Pairs", pairs: pairs})
+				continue
+			}
+
+			list := []Node{}
+			for j := 0; j < fv.Len(); j++ {
+				if n, ok := fv.Index(j).Interface().(Node); ok {
+					list = append(list, n)
+				}
+			}
+			children = append(children, child{name: f.Name, list: list})
+		case reflect.Map:
+			// covered by Keys
+		default:
+			n, _ := fv.Interface().(Node)
+			if IsNil(n) {
+				continue
+			}
+			children = append(children, child{name: f.Name, node: n})
+		}
+	}
+
+	return children
+}
+
+// whether a field holds nodes: a node itself, or a slice/map of them
+func isNodeField(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map:
+		return t.Elem().Implements(nodeType)
+	default:
+		return t.Implements(nodeType)
+	}
+}
+
+// IsNil reports whether there's no node: the parser sometimes leaves typed
+// nil pointers behind (e.g. the Alternative of an if without an else), so a
+// plain == nil isn't enough
+func IsNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func nodeKind(node Node) string {
+	return reflect.TypeOf(node).Elem().Name()
+}
+
+func jsonName(field string) string {
+	return strings.ToLower(field[:1]) + field[1:]
+}
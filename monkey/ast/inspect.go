@@ -0,0 +1,68 @@
+package ast
+
+/*
+Inspect walks the tree under node depth first, like go/ast's Inspect: it
+calls f with node, and if f returns true goes on to each of node's
+children, in the order they're in in the source. returning false skips
+what's under a node, which is how a walk that keeps state of its own (a
+scope, say) handles the nodes it cares about and leaves the rest to
+Inspect
+
+nil nodes are skipped, f never sees one - the parser leaves typed nil
+pointers behind where something didn't parse, and for an if without an
+else
+*/
+func Inspect(node Node, f func(Node) bool) {
+	if IsNil(node) || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, f)
+		}
+	case *LetStatement:
+		Inspect(node.Name, f)
+		Inspect(node.Value, f)
+	case *ReturnStatement:
+		Inspect(node.ReturnValue, f)
+	case *ExpressionStatement:
+		Inspect(node.Expression, f)
+	case *BlockStatement:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, f)
+		}
+	case *PrefixExpression:
+		Inspect(node.Right, f)
+	case *InfixExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Right, f)
+	case *IfExpression:
+		Inspect(node.Condition, f)
+		Inspect(node.Consequence, f)
+		Inspect(node.Alternative, f)
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			Inspect(param, f)
+		}
+		Inspect(node.Body, f)
+	case *CallExpression:
+		Inspect(node.Function, f)
+		for _, arg := range node.Arguments {
+			Inspect(arg, f)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			Inspect(el, f)
+		}
+	case *IndexExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Index, f)
+	case *HashLiteral:
+		for _, key := range node.Keys {
+			Inspect(key, f)
+			Inspect(node.Pairs[key], f)
+		}
+	}
+}
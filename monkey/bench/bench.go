@@ -0,0 +1,153 @@
+/*
+Package bench is a suite of monkey programs that gets run on both engines,
+so they can be compared with each other and with themselves over time.
+it's used by `monkey bench` and by the go benchmarks in this package:
+
+	go test ./bench -run NONE -bench . -benchmem
+
+parsing happens once per program, and so does compiling for the vm - what
+gets timed is evaluating the tree or running the bytecode (on a new vm
+every time, since that's part of running a program)
+*/
+package bench
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+)
+
+// a program has to come out with Expected (compared using Inspect), so
+// an engine that's broken can't look fast
+type Program struct {
+	Name     string
+	Source   string
+	Expected string
+}
+
+var Programs = []Program{
+	{"fib", `
+	let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+	fib(20)`, "6765"},
+
+	// there are no loops, so a loop is a function calling itself - kept
+	// under the vm's MaxFrames deep, and run a few times
+	{"loop-sum", `
+	let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } };
+	let times = fn(n) { if (n == 0) { 0 } else { sum(300, 0) + times(n - 1) } };
+	times(40)`, "1806000"},
+
+	{"map-filter", `
+	let range = fn(n, acc) { if (n == 0) { acc } else { range(n - 1, push(acc, n)) } };
+	let map = fn(arr, f) { if (len(arr) == 0) { [] } else { let h = f(first(arr)); push(map(rest(arr), f), h) } };
+	let filter = fn(arr, f) { if (len(arr) == 0) { [] } else { let kept = filter(rest(arr), f); if (f(first(arr))) { push(kept, first(arr)) } else { kept } } };
+	let reduce = fn(arr, acc, f) { if (len(arr) == 0) { acc } else { reduce(rest(arr), f(acc, first(arr)), f) } };
+	let numbers = range(300, []);
+	let evens = filter(map(numbers, fn(x) { x * 3 }), fn(x) { x / 2 * 2 == x });
+	reduce(evens, 0, fn(a, b) { a + b })`, "67950"},
+
+	{"closures", `
+	let adder = fn(x) { fn(y) { x + y } };
+	let apply = fn(n, acc) { if (n == 0) { acc } else { apply(n - 1, adder(n)(acc)) } };
+	let times = fn(n) { if (n == 0) { 0 } else { apply(300, 0) + times(n - 1) } };
+	times(20)`, "903000"},
+
+	{"strings", `
+	let repeat = fn(s, n) { if (n == 0) { "" } else { s + repeat(s, n - 1) } };
+	len(repeat("ab", 500))`, "1000"},
+
+	{"hashes", `
+	let h = {"a": 1, "b": 2, "c": 3, 4: "four", true: "yes"};
+	let look = fn(n, acc) { if (n == 0) { acc } else { look(n - 1, acc + h["a"] + h["c"] + len(h[4])) } };
+	let times = fn(n) { if (n == 0) { 0 } else { look(300, 0) + times(n - 1) } };
+	times(20)`, "48000"},
+}
+
+// Engine turns a parsed program into something that runs it. what it
+// does before returning (compiling, for the vm) isn't timed
+type Engine struct {
+	Name    string
+	Prepare func(program *ast.Program) (run func() (object.Object, error), err error)
+}
+
+var Engines = []Engine{
+	{"eval", prepareEval},
+	{"vm", prepareVM},
+}
+
+func prepareEval(program *ast.Program) (func() (object.Object, error), error) {
+	return func() (object.Object, error) {
+		result := evaluator.Eval(program, object.NewEnvironment())
+		if err, ok := result.(*object.Error); ok {
+			return nil, fmt.Errorf("%s", err.Message)
+		}
+		return result, nil
+	}, nil
+}
+
+func prepareVM(program *ast.Program) (func() (object.Object, error), error) {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	bytecode := comp.Bytecode()
+
+	return func() (object.Object, error) {
+		machine := vm.New(bytecode)
+		if err := machine.Run(); err != nil {
+			return nil, err
+		}
+		return machine.LastPoppedStackElem(), nil
+	}, nil
+}
+
+/*
+Prepare parses and prepares p for e and runs it once to check that it
+comes out right. what it gives back runs p again, which is the part to
+time - in a go benchmark or with testing.Benchmark, as monkey bench does
+*/
+func Prepare(p Program, e Engine) (func() error, error) {
+	l := lexer.New(p.Source)
+	ps := parser.New(l)
+
+	program := ps.ParseProgram()
+	if len(ps.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: parse error: %s", p.Name, ps.Errors()[0])
+	}
+
+	run, err := e.Prepare(program)
+	if err != nil {
+		return nil, fmt.Errorf("%s on %s: %s", p.Name, e.Name, err)
+	}
+
+	if err := check(p, e, run); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		if _, err := run(); err != nil {
+			return fmt.Errorf("%s on %s: %s", p.Name, e.Name, err)
+		}
+		return nil
+	}, nil
+}
+
+func check(p Program, e Engine, run func() (object.Object, error)) error {
+	result, err := run()
+	if err != nil {
+		return fmt.Errorf("%s on %s: %s", p.Name, e.Name, err)
+	}
+	if result == nil || result.Inspect() != p.Expected {
+		got := "nothing"
+		if result != nil {
+			got = result.Inspect()
+		}
+		return fmt.Errorf("%s on %s: wrong result. want=%s, got=%s", p.Name, e.Name, p.Expected, got)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package bench
+
+import "testing"
+
+// every program has to run, and come out right, on every engine
+func TestPrograms(t *testing.T) {
+	for _, p := range Programs {
+		for _, e := range Engines {
+			if _, err := Prepare(p, e); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+}
+
+func BenchmarkEngines(b *testing.B) {
+	for _, p := range Programs {
+		for _, e := range Engines {
+			run, err := Prepare(p, e)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(p.Name+"/"+e.Name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if err := run(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
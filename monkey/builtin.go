@@ -0,0 +1,117 @@
+package monkey
+
+import (
+	"fmt"
+	"monkey/object"
+	"reflect"
+)
+
+// RegisterBuiltin makes fn a builtin called name for the programs that run
+// from now on - for a host function that deals in monkey objects itself.
+// like the builtins in the object package it returns nil for null and an
+// *object.Error to stop the program
+func (interp *Interpreter) RegisterBuiltin(name string, fn func(args ...object.Object) object.Object) {
+	interp.define(name, &object.Builtin{Fn: fn})
+}
+
+/*
+RegisterFunc is RegisterBuiltin for a plain go function, so the host
+doesn't have to look at objects at all:
+
+	interp.RegisterFunc("fetchUser", func(id int) (*User, error) {
+		return db.User(id)
+	})
+
+the arguments are converted to fn's parameter types with FromValue and
+what it returns back with ToValue. fn can return nothing, a value, an
+error or a value and an error - an error that isn't nil stops the
+program like any other runtime error. a variadic fn takes any number of
+arguments past the fixed ones
+
+fn is checked right away, one that can't be called like that is an error
+*/
+func (interp *Interpreter) RegisterFunc(name string, fn any) error {
+	builtin, err := WrapFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	interp.define(name, builtin)
+	return nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// WrapFunc turns fn into the builtin RegisterFunc would register, with
+// name used in its error messages
+func WrapFunc(name string, fn any) (*object.Builtin, error) {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func || rv.IsNil() {
+		return nil, fmt.Errorf("monkey: %s: want a function, got %T", name, fn)
+	}
+
+	t := rv.Type()
+	returnsValue, returnsError := false, false
+	switch t.NumOut() {
+	case 0:
+	case 1:
+		returnsError = t.Out(0) == errorType
+		returnsValue = !returnsError
+	case 2:
+		if t.Out(1) != errorType {
+			return nil, fmt.Errorf("monkey: %s: the second result has to be an error, got %s", name, t.Out(1))
+		}
+		returnsValue, returnsError = true, true
+	default:
+		return nil, fmt.Errorf("monkey: %s: too many results (%d)", name, t.NumOut())
+	}
+
+	fixed := t.NumIn()
+	if t.IsVariadic() {
+		fixed--
+	}
+
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if t.IsVariadic() && len(args) < fixed {
+			return &object.Error{Message: fmt.Sprintf("wrong number of arguments. got=%d, want at least %d",
+				len(args), fixed)}
+		}
+		if !t.IsVariadic() && len(args) != fixed {
+			return &object.Error{Message: fmt.Sprintf("wrong number of arguments. got=%d, want=%d",
+				len(args), fixed)}
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var paramType reflect.Type
+			if i < fixed {
+				paramType = t.In(i)
+			} else {
+				paramType = t.In(fixed).Elem()
+			}
+
+			param := reflect.New(paramType).Elem()
+			n := 0
+			if err := fromValue(arg, param, &n); err != nil {
+				return &object.Error{Message: fmt.Sprintf("argument %d to `%s`: %s", i+1, name, err)}
+			}
+			in[i] = param
+		}
+
+		out := rv.Call(in)
+
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+			}
+		}
+		if !returnsValue {
+			return nil
+		}
+
+		result, err := toValue(out[0], 0)
+		if err != nil {
+			return &object.Error{Message: fmt.Sprintf("result of `%s`: %s", name, err)}
+		}
+		return result
+	}}, nil
+}
@@ -0,0 +1,140 @@
+package monkey
+
+import (
+	"errors"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestRegisterBuiltin(t *testing.T) {
+	for name, interp := range engines() {
+		interp.RegisterBuiltin("twice", func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return &object.Error{Message: "twice takes one argument"}
+			}
+			return &object.Array{Elements: []object.Object{args[0], args[0]}}
+		})
+
+		v, err := interp.Eval(`twice("a")`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if v.String() != "[a, a]" {
+			t.Errorf("%s: wrong value. want=[a, a], got=%s", name, v)
+		}
+
+		_, err = interp.Eval("twice()")
+		if err == nil || err.Error() != "1:6: twice takes one argument" {
+			t.Errorf("%s: wrong error. got=%v", name, err)
+		}
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	users := map[int]*user{1: {Name: "ann", Age: 37}}
+
+	funcs := map[string]any{
+		"fetchUser": func(id int) (*user, error) {
+			u, ok := users[id]
+			if !ok {
+				return nil, errors.New("no such user")
+			}
+			return u, nil
+		},
+		"sum": func(nums ...int) int {
+			total := 0
+			for _, n := range nums {
+				total += n
+			}
+			return total
+		},
+		"join": func(sep string, parts []string) string { return strings.Join(parts, sep) },
+		"check": func(ok bool) error {
+			if !ok {
+				return errors.New("check failed")
+			}
+			return nil
+		},
+		"nothing": func() {},
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fetchUser(1)["age"]`, "37"},
+		{`fetchUser(1)["Name"]`, "ann"},
+		{"sum()", "0"},
+		{"sum(1, 2, 3)", "6"},
+		{`join("-", ["a", "b"])`, "a-b"},
+		{"check(true)", "null"},
+		{"nothing()", "null"},
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"fetchUser(2)", "1:10: fetchUser: no such user"},
+		{"fetchUser()", "1:10: wrong number of arguments. got=0, want=1"},
+		{`fetchUser("1")`, "1:10: argument 1 to `fetchUser`: can't convert STRING to int"},
+		{`sum(1, "2")`, "1:4: argument 2 to `sum`: can't convert STRING to int"},
+		{"check(false)", "1:6: check: check failed"},
+	}
+
+	for name, interp := range engines() {
+		for fnName, fn := range funcs {
+			if err := interp.RegisterFunc(fnName, fn); err != nil {
+				t.Fatalf("%s: %s: unexpected error: %s", name, fnName, err)
+			}
+		}
+
+		for _, tt := range tests {
+			v, err := interp.Eval(tt.input)
+			if err != nil {
+				t.Errorf("%s: %q: unexpected error: %s", name, tt.input, err)
+				continue
+			}
+			if v.String() != tt.expected {
+				t.Errorf("%s: %q: wrong value. want=%s, got=%s", name, tt.input, tt.expected, v)
+			}
+		}
+
+		for _, tt := range errorTests {
+			_, err := interp.Eval(tt.input)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("%s: %q: wrong error. want=%q, got=%v", name, tt.input, tt.expected, err)
+			}
+		}
+	}
+}
+
+func TestWrapFuncErrors(t *testing.T) {
+	tests := []struct {
+		fn       any
+		expected string
+	}{
+		{42, "want a function, got int"},
+		{(func())(nil), "want a function"},
+		{func() (int, int) { return 0, 0 }, "the second result has to be an error, got int"},
+		{func() (int, int, error) { return 0, 0, nil }, "too many results (3)"},
+	}
+
+	for _, tt := range tests {
+		_, err := WrapFunc("f", tt.fn)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%T: wrong error. want=%q, got=%v", tt.fn, tt.expected, err)
+		}
+	}
+
+	// a result that can't be converted only shows up when it's called
+	builtin, err := WrapFunc("f", func() float64 { return 0 })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	errObj, ok := builtin.Fn().(*object.Error)
+	if !ok || errObj.Message != "result of `f`: can't convert float64 to a monkey value" {
+		t.Errorf("wrong error. got=%v", builtin.Fn())
+	}
+}
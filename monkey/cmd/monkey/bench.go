@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/bench"
+	"regexp"
+	"testing"
+	"text/tabwriter"
+)
+
+/*
+benchCommand runs the programs of the bench package on both engines and
+prints the numbers next to each other, one program per line:
+
+	program  eval ns/op  vm ns/op  speedup  eval allocs/op  vm allocs/op  eval B/op  vm B/op
+	    fib    24760582   4343893    5.70x          164185            12    8669238  1049014
+
+every program gets timed for about a second per engine, and the table is
+printed once they're all done
+
+-run picks the programs by name, like go test -run does. a program that
+doesn't come out with the result it should is an error (exit code 1),
+so the numbers of a broken engine don't get taken for a speedup
+*/
+func benchCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey bench [-run regexp]")
+		flags.PrintDefaults()
+	}
+
+	pattern := flags.String("run", "", "only run the programs whose name matches `regexp`")
+
+	if err := flags.Parse(args); err != nil {
+		return exitSyntaxError
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitSyntaxError
+	}
+
+	match, err := regexp.Compile(*pattern)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: bad -run pattern: %s\n", err)
+		return exitSyntaxError
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "program\teval ns/op\tvm ns/op\tspeedup\teval allocs/op\tvm allocs/op\teval B/op\tvm B/op\t")
+
+	for _, p := range bench.Programs {
+		if !match.MatchString(p.Name) {
+			continue
+		}
+
+		results := map[string]testing.BenchmarkResult{}
+		for _, e := range bench.Engines {
+			run, err := bench.Prepare(p, e)
+			if err != nil {
+				fmt.Fprintf(stderr, "monkey: %s\n", err)
+				return exitRuntimeError
+			}
+
+			// it already came out right once, so an error now is the
+			// engine's fault - b.Fatal would only leave the result at zero
+			res := testing.Benchmark(func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N && err == nil; i++ {
+					err = run()
+				}
+			})
+			if err != nil {
+				fmt.Fprintf(stderr, "monkey: %s\n", err)
+				return exitRuntimeError
+			}
+			results[e.Name] = res
+		}
+
+		eval, vm := results["eval"], results["vm"]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2fx\t%d\t%d\t%d\t%d\t\n", p.Name,
+			eval.NsPerOp(), vm.NsPerOp(), float64(eval.NsPerOp())/float64(vm.NsPerOp()),
+			eval.AllocsPerOp(), vm.AllocsPerOp(), eval.AllocedBytesPerOp(), vm.AllocedBytesPerOp())
+	}
+
+	w.Flush()
+	return exitOK
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+buildCommand compiles a script to bytecode and writes it to a .mkyc file
+(script.mky becomes script.mkyc unless -o says otherwise), which monkey run
+then runs on the vm without lexing, parsing or compiling it again
+
+the file is only good for the monkey it was built with: when the bytecode
+format changes, monkey run refuses older files and they have to be built
+again from the source
+*/
+func buildCommand(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey build [-o out.mkyc] <file>")
+		flags.PrintDefaults()
+	}
+
+	out := flags.String("o", "", "write the bytecode to `file` (default: the script's name with .mkyc)")
+
+	if err := flags.Parse(args); err != nil {
+		return exitSyntaxError
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitSyntaxError
+	}
+
+	path := flags.Arg(0)
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitRuntimeError
+	}
+	if compiler.IsBytecode(src) {
+		fmt.Fprintf(stderr, "monkey: %s is already compiled\n", path)
+		return exitSyntaxError
+	}
+
+	program, code := parseSource(path, string(src), stderr)
+	if code != exitOK {
+		return code
+	}
+
+	bytecode, code := compileVM(program, path, string(src), stderr)
+	if code != exitOK {
+		return code
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(path, filepath.Ext(path)) + ".mkyc"
+	}
+
+	// encoded in memory first, so a failed build doesn't leave half a file
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, bytecode); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s: %s\n", path, err)
+		return exitRuntimeError
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitRuntimeError
+	}
+
+	return exitOK
+}
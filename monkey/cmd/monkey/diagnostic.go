@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// exit codes, so scripts and CI can tell a program that doesn't parse
+// from one that failed while running
+const (
+	exitOK           = 0
+	exitRuntimeError = 1 // also used when the file can't be read
+	exitSyntaxError  = 2 // lexer or parser errors, and bad command line usage
+)
+
+/*
+printDiagnostic writes an error in the usual file:line:column: message form
+editors know how to jump to, followed by the offending source line and a
+caret under the column:
+
+	script.mky:3:7: type mismatch: INTEGER + BOOLEAN
+	  add(1 + true);
+	        ^
+
+the caret line copies the tabs from the source line so the caret still
+lines up when the line is indented with tabs. without src (a .mkyc file
+has none) it's just the first line
+*/
+func printDiagnostic(w io.Writer, path, src string, line, column int, msg string) {
+	if line <= 0 {
+		fmt.Fprintf(w, "%s: %s\n", path, msg)
+		return
+	}
+
+	fmt.Fprintf(w, "%s:%d:%d: %s\n", path, line, column, msg)
+
+	lines := strings.Split(src, "\n")
+	if src == "" || line > len(lines) {
+		return
+	}
+
+	text := strings.TrimRight(lines[line-1], "\r")
+	fmt.Fprintf(w, "  %s\n", text)
+
+	var caret strings.Builder
+	for i := 0; i < column-1 && i < len(text); i++ {
+		if text[i] == '\t' {
+			caret.WriteByte('\t')
+		} else {
+			caret.WriteByte(' ')
+		}
+	}
+	fmt.Fprintf(w, "  %s^\n", caret.String())
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/doc"
+	"os"
+	"strings"
+)
+
+/*
+docCommand prints the documentation of scripts, from their /// comments
+(see the doc package for what goes where):
+
+	monkey doc lib.mky                    markdown, on stdout
+	monkey doc -html -o lib.html lib.mky  one html page, in lib.html
+
+with several files they all end up on the same page, one after the
+other. a file that doesn't parse has its errors reported instead and
+makes the exit code 2, and nothing gets written
+*/
+func docCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey doc [-html] [-o file] <file>...")
+		flags.PrintDefaults()
+	}
+
+	asHTML := flags.Bool("html", false, "write an html page instead of markdown")
+	out := flags.String("o", "", "write to `file` instead of stdout")
+
+	if err := flags.Parse(args); err != nil {
+		return exitSyntaxError
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitSyntaxError
+	}
+
+	code := exitOK
+	var files []*doc.File
+
+	for _, path := range flags.Args() {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			code = max(code, exitRuntimeError)
+			continue
+		}
+
+		f, parseErrors := doc.Source(string(src))
+		if len(parseErrors) > 0 {
+			for _, err := range parseErrors {
+				printDiagnostic(stderr, path, string(src), err.Line, err.Column, err.Message)
+			}
+			code = exitSyntaxError
+			continue
+		}
+		f.Name = path
+		files = append(files, f)
+	}
+	if code != exitOK {
+		return code
+	}
+
+	var buf bytes.Buffer
+	if *asHTML {
+		doc.HTML(&buf, strings.Join(flags.Args(), ", "), files...)
+	} else {
+		doc.Markdown(&buf, files...)
+	}
+
+	if *out == "" {
+		stdout.Write(buf.Bytes())
+		return exitOK
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitRuntimeError
+	}
+	return exitOK
+}
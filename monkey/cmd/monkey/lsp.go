@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/lsp"
+)
+
+/*
+lspCommand runs the language server (see the lsp package) on stdin and
+stdout, for an editor to start. all it needs is to be told to run
+`monkey lsp` for .mky files, e.g. in neovim:
+
+	vim.lsp.start({ name = "monkey", cmd = { "monkey", "lsp" } })
+
+it exits with 0 once the editor shuts it down, and 1 if the connection
+broke (or the editor went away without shutting it down)
+*/
+func lspCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey lsp")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return exitSyntaxError
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitSyntaxError
+	}
+
+	if err := lsp.Serve(stdin, stdout); err != nil {
+		fmt.Fprintf(stderr, "monkey: lsp: %s\n", err)
+		return exitRuntimeError
+	}
+	return exitOK
+}
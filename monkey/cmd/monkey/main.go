@@ -0,0 +1,147 @@
+/*
+the monkey command:
+
+	monkey                          starts the REPL, or runs stdin if it isn't a terminal
+	monkey repl [flags]             starts the REPL (see replCommand for flags)
+	monkey run [flags] file.mky     runs a script (see runCommand for flags)
+	monkey run -e 'source'          runs source and prints its value
+	monkey [flags] file.mky         same as monkey run
+	monkey build [-o out] file.mky  compiles a script to file.mkyc (see buildCommand)
+	monkey run file.mkyc            runs a compiled script without parsing it again
+	monkey bench [-run regexp]      compares the engines on the bench package's programs
+	monkey lsp                      runs the language server on stdin/stdout (see lspCommand)
+	monkey vet [flags] file.mky...  reports suspicious code (see vetCommand for flags)
+	monkey test [flags] [path...]   runs the tests in *_test.mky files (see testCommand)
+	monkey doc [flags] file.mky...  prints documentation from /// comments (see docCommand)
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"monkey/repl"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is main without the os.Exit, so tests can call it and check the exit
+// code and what was written
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		// echo 'puts(1 + 2)' | monkey runs the piped program instead of
+		// starting a REPL nobody is typing into
+		if !isTerminal(stdin) {
+			return runCommand([]string{"-"}, stdin, stdout, stderr)
+		}
+		return replCommand(nil, stdin, stdout, stderr)
+	}
+
+	switch args[0] {
+	case "repl":
+		return replCommand(args[1:], stdin, stdout, stderr)
+	case "run":
+		return runCommand(args[1:], stdin, stdout, stderr)
+	case "build":
+		return buildCommand(args[1:], stderr)
+	case "bench":
+		return benchCommand(args[1:], stdout, stderr)
+	case "lsp":
+		return lspCommand(args[1:], stdin, stdout, stderr)
+	case "vet":
+		return vetCommand(args[1:], stdout, stderr)
+	case "test":
+		return testCommand(args[1:], stdout, stderr)
+	case "doc":
+		return docCommand(args[1:], stdout, stderr)
+	default:
+		return runCommand(args, stdin, stdout, stderr)
+	}
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+/*
+replCommand starts the REPL. both settings can come from a flag or, when
+the flag isn't given, from an environment variable:
+  - the prompt: --prompt, then MONKEY_PROMPT, then ">> "
+  - a startup file of helper definitions: --rc, then MONKEYRC, then
+    ~/.monkeyrc - which is only loaded if it exists, since most people
+    won't have one. --no-rc skips the startup file altogether
+*/
+func replCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	prompt := flags.String("prompt", os.Getenv("MONKEY_PROMPT"), "the prompt to show (default \">> \")")
+	rc := flags.String("rc", os.Getenv("MONKEYRC"), "a monkey `file` to evaluate before the first prompt (default ~/.monkeyrc)")
+	noRC := flags.Bool("no-rc", false, "don't load a startup file")
+
+	if err := flags.Parse(args); err != nil {
+		return exitSyntaxError
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintln(stderr, "usage: monkey repl [flags]")
+		flags.PrintDefaults()
+		return exitSyntaxError
+	}
+
+	cfg := repl.Config{Prompt: *prompt, StartupFile: *rc}
+
+	switch {
+	case *noRC:
+		cfg.StartupFile = ""
+	case cfg.StartupFile == "":
+		cfg.StartupFile = defaultStartupFile()
+	}
+
+	greet(stdout)
+	repl.StartWithConfig(stdin, stdout, cfg)
+
+	return exitOK
+}
+
+// ~/.monkeyrc if there is one, otherwise ""
+func defaultStartupFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	path := filepath.Join(home, ".monkeyrc")
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return ""
+	}
+
+	return path
+}
+
+func greet(out io.Writer) {
+	user, err := user.Current()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(out, "Hello %s! This is the Monkey programming language!\n",
+		user.Username)
+	fmt.Fprintf(out, "Feel free to type in commands\n")
+}
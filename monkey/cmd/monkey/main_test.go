@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunFile(t *testing.T) {
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStderr string
+	}{
+		{[]string{"run", "testdata/ok.mky"}, 0, ""},
+		{[]string{"testdata/ok.mky"}, 0, ""},
+		{[]string{"run", "testdata/runtime_error.mky"}, 1,
+			"testdata/runtime_error.mky:1:24: type mismatch: INTEGER + BOOLEAN\n" +
+				"  let add = fn(x, y) { x + y };\n" +
+				"                         ^\n"},
+		{[]string{"run", "testdata/parse_error.mky"}, 2,
+			"testdata/parse_error.mky:1:5: expected next token to be IDENT, got = instead\n" +
+				"  let = 5;\n" +
+				"      ^\n"},
+		{[]string{"run"}, 2, "usage: monkey run [flags] <file> [args...]\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. expected=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+
+		if !strings.HasPrefix(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: wrong stderr. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestEngines(t *testing.T) {
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"run", "testdata/ok.mky"}, 0, "", ""},
+		{[]string{"run", "testdata/runtime_error.mky"}, 1, "",
+			"testdata/runtime_error.mky:1:24: type mismatch: INTEGER + BOOLEAN\n" +
+				"  let add = fn(x, y) { x + y };\n" +
+				"                         ^\n"},
+		{[]string{"-e", `let f = fn(n) { if (n < 2) { n } else { f(n - 1) + f(n - 2) } }; f(10)`}, 0, "55\n", ""},
+		{[]string{"-e", `let x = 1;`}, 0, "", ""},
+		{[]string{"-e", `first(ARGV) + "!"`, "hi"}, 0, "hi!\n", ""},
+		{[]string{"-e", `puts(nope)`}, 1, "", "-e:1:6: identifier not found: nope\n"},
+		{[]string{"-e", `puts("a", 1 + 2)`}, 0, "a\n3\n", ""},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []string{"eval", "vm"} {
+			args := append([]string{"--engine=" + engine}, tt.args...)
+			if tt.args[0] == "run" {
+				args = append([]string{"run", "--engine=" + engine}, tt.args[1:]...)
+			}
+
+			var stdout, stderr bytes.Buffer
+
+			code := run(args, strings.NewReader(""), &stdout, &stderr)
+			if code != tt.expectedCode {
+				t.Errorf("%v: wrong exit code. expected=%d, got=%d", args, tt.expectedCode, code)
+			}
+
+			if stdout.String() != tt.expectedStdout {
+				t.Errorf("%v: wrong stdout. expected=%q, got=%q", args, tt.expectedStdout, stdout.String())
+			}
+
+			if !strings.HasPrefix(stderr.String(), tt.expectedStderr) {
+				t.Errorf("%v: wrong stderr. expected=%q, got=%q", args, tt.expectedStderr, stderr.String())
+			}
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--engine=jit", "-e", "1"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("unknown engine: wrong exit code. expected=2, got=%d", code)
+	}
+}
+
+func TestRunMissingFile(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	if code := run([]string{"run", "testdata/nope.mky"}, strings.NewReader(""), &stdout, &stderr); code != 1 {
+		t.Errorf("wrong exit code. expected=1, got=%d", code)
+	}
+
+	if !strings.HasPrefix(stderr.String(), "monkey: ") {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+}
+
+func TestBuildAndRunBytecode(t *testing.T) {
+	dir := t.TempDir()
+
+	script := filepath.Join(dir, "args.mky")
+	if err := os.WriteFile(script, []byte("let n = len(ARGV);\nARGV[0] + n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	compiled := filepath.Join(dir, "args.mkyc")
+	hello := filepath.Join(dir, "hello.mky")
+	if err := os.WriteFile(hello, []byte(`puts("hello")`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := filepath.Join(dir, "corrupt.mkyc")
+	if err := os.WriteFile(corrupt, []byte("MKYC\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStderr string
+	}{
+		{[]string{"build", script}, 0, ""},
+		{[]string{"build", hello}, 0, ""},
+		{[]string{"run", compiled, "x"}, 1, compiled + ":2:9: type mismatch: STRING + INTEGER\n"},
+		{[]string{compiled}, 1, compiled + ":2:9: type mismatch: NULL + INTEGER\n"},
+		{[]string{"run", "--ast", compiled}, 2, "monkey: " + compiled + " is compiled bytecode"},
+		{[]string{"build", "-o", filepath.Join(dir, "ok.mkyc"), "testdata/ok.mky"}, 0, ""},
+		{[]string{"run", filepath.Join(dir, "ok.mkyc")}, 0, ""},
+		{[]string{"build", "testdata/parse_error.mky"}, 2, "testdata/parse_error.mky:1:5: expected next token"},
+		{[]string{"build", compiled}, 2, "monkey: " + compiled + " is already compiled\n"},
+		{[]string{"build"}, 2, "usage: monkey build"},
+		{[]string{"run", corrupt}, 1, "monkey: " + corrupt + ": corrupt bytecode: unexpected EOF\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. expected=%d, got=%d (%s)", tt.args, tt.expectedCode, code, stderr.String())
+		}
+
+		if !strings.HasPrefix(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: wrong stderr. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{filepath.Join(dir, "hello.mkyc")}, strings.NewReader(""), &stdout, &stderr); code != 0 || stdout.String() != "hello\n" {
+		t.Errorf("puts from bytecode: wrong result. got=%d, %q (%s)", code, stdout.String(), stderr.String())
+	}
+}
+
+func TestStageDumps(t *testing.T) {
+	tests := []struct {
+		args           []string
+		expectedStdout string
+	}{
+		{[]string{"run", "--tokens", "testdata/ok.mky"}, "1:1\tLET\t\"let\"\n1:5\tIDENT\t\"add\"\n1:9\t=\n"},
+		{[]string{"--ast", "testdata/ok.mky"}, "Program\n  Statements:\n    LetStatement 1:1\n"},
+		{[]string{"--ast-json", "testdata/ok.mky"}, "{\n  \"node\": \"Program\",\n  \"statements\": [\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		if code := run(tt.args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+			t.Errorf("%v: wrong exit code. expected=0, got=%d (%s)", tt.args, code, stderr.String())
+		}
+
+		if !strings.HasPrefix(stdout.String(), tt.expectedStdout) {
+			t.Errorf("%v: wrong stdout.\nexpected prefix=%q\ngot=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+	}
+}
+
+func TestTraceFlag(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	if code := run([]string{"run", "--trace", "testdata/ok.mky"}, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("wrong exit code. expected=0, got=%d (%s)", code, stderr.String())
+	}
+
+	if !strings.Contains(stderr.String(), "InfixExpression (x + y) => 3\n") {
+		t.Errorf("trace missing evaluation of x + y. got=%q", stderr.String())
+	}
+}
+
+func TestStatsFlag(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	if code := run([]string{"run", "--engine=vm", "--stats", "testdata/ok.mky"}, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("wrong exit code. expected=0, got=%d (%s)", code, stderr.String())
+	}
+
+	if !strings.HasPrefix(stderr.String(), "vm: 1 calls, 2 frames deep\n"+
+		"vm: allocated 0 integers (1 cached), 0 strings, 0 arrays, 0 hashes, 1 closures\ngo: ") {
+		t.Errorf("wrong stats. got=%q", stderr.String())
+	}
+
+	stderr.Reset()
+	if code := run([]string{"run", "--stats", "testdata/ok.mky"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("--stats without the vm: wrong exit code. expected=2, got=%d", code)
+	}
+}
+
+func TestProfileFlag(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "prof.pb.gz")
+
+	for _, engine := range []string{"eval", "vm"} {
+		var stdout, stderr bytes.Buffer
+		args := []string{"run", "--engine=" + engine, "--profile", "--profile-out=" + out, "testdata/ok.mky"}
+		if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+			t.Fatalf("%s: wrong exit code. expected=0, got=%d (%s)", engine, code, stderr.String())
+		}
+
+		if !strings.HasPrefix(stderr.String(), "profile: ") || !strings.Contains(stderr.String(), "  function\n") {
+			t.Errorf("%s: wrong profile. got=%q", engine, stderr.String())
+		}
+		if strings.Contains(stderr.String(), "opcode") != (engine == "vm") {
+			t.Errorf("%s: only the vm counts opcodes. got=%q", engine, stderr.String())
+		}
+
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+			t.Errorf("%s: --profile-out didn't write a gzipped profile", engine)
+		}
+	}
+}
+
+// the programs themselves get run by the bench package's tests, this only
+// checks the command around them
+func TestBenchCommand(t *testing.T) {
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"bench", "-run", "^nothing$"}, 0, "  program  eval ns/op  vm ns/op  speedup", ""},
+		{[]string{"bench", "-run", "("}, 2, "", "monkey: bad -run pattern"},
+		{[]string{"bench", "fib"}, 2, "", "usage: monkey bench"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. expected=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+
+		if !strings.HasPrefix(stdout.String(), tt.expectedStdout) {
+			t.Errorf("%v: wrong stdout. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+
+		if !strings.HasPrefix(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: wrong stderr. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestLSPCommand(t *testing.T) {
+	frame := func(msgs ...string) string {
+		var b strings.Builder
+		for _, msg := range msgs {
+			fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		args           []string
+		stdin          string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"lsp"}, frame(`{"jsonrpc":"2.0","id":1,"method":"shutdown"}`, `{"jsonrpc":"2.0","method":"exit"}`), 0,
+			"Content-Length: 38\r\n\r\n{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":null}", ""},
+		{[]string{"lsp"}, frame(`{"jsonrpc":"2.0","method":"exit"}`), 1, "", "monkey: lsp: exit without shutdown"},
+		{[]string{"lsp"}, "Content-Length: 10\r\n\r\n{}", 1, "", "monkey: lsp: unexpected EOF"},
+		{[]string{"lsp", "x.mky"}, "", 2, "", "usage: monkey lsp"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. expected=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("%v: wrong stdout. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+
+		if !strings.HasPrefix(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: wrong stderr. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestVetCommand(t *testing.T) {
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"vet", "testdata/ok.mky"}, 0, "", ""},
+		{[]string{"vet", "testdata/vet.mky"}, 1, "",
+			"testdata/vet.mky:2:6: count is never used (unused)\n" +
+				"  \tlet count = len(xs);\n" +
+				"  \t    ^\n" +
+				"testdata/vet.mky:4:2: unreachable code (unreachable)\n"},
+		{[]string{"vet", "-unused=false", "-unreachable=false", "testdata/vet.mky"}, 1, "",
+			"testdata/vet.mky:6:1: condition is always true (constant)\n"},
+		{[]string{"vet", "-constant", "testdata/vet.mky"}, 1, "",
+			"testdata/vet.mky:6:1: condition is always true (constant)\n"},
+		{[]string{"vet", "-json", "-unused", "testdata/vet.mky"}, 1,
+			"[\n\t{\n\t\t\"file\": \"testdata/vet.mky\",\n\t\t\"rule\": \"unused\",\n" +
+				"\t\t\"line\": 2,\n\t\t\"column\": 6,\n\t\t\"message\": \"count is never used\"\n\t}\n]\n", ""},
+		{[]string{"vet", "-json", "testdata/ok.mky"}, 0, "[]\n", ""},
+		{[]string{"vet", "testdata/parse_error.mky"}, 2, "",
+			"testdata/parse_error.mky:1:5: expected next token to be IDENT, got = instead\n"},
+		{[]string{"vet"}, 2, "", "usage: monkey vet [flags] <file>...\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. expected=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("%v: wrong stdout. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+
+		if !strings.HasPrefix(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: wrong stderr. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestTestCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{
+			[]string{"test", "testdata/tests"},
+			1,
+			`--- FAIL: test_sub
+testdata/tests/math_test.mky:10:11: assertion failed: got 4, want 2
+  	assert_eq(sub(3, 1), 2);
+  	         ^
+FAIL	testdata/tests/math_test.mky (1 passed, 1 failed)
+ok  	testdata/tests/strings_test.mky (2 passed)
+3 passed, 1 failed
+`,
+		},
+		{
+			[]string{"test", "-v", "-parallel", "4", "-run", "add|greet", "testdata/tests"},
+			0,
+			`--- PASS: test_add
+ok  	testdata/tests/math_test.mky (1 passed)
+--- PASS: test_greet
+ok  	testdata/tests/strings_test.mky (1 passed)
+2 passed, 0 failed
+`,
+		},
+		// named on the command line, so it's run even though it isn't a _test.mky
+		{[]string{"test", "testdata/ok.mky"}, 0, "ok  \ttestdata/ok.mky [no tests]\n"},
+		{[]string{"test", "testdata/parse_error.mky"}, 2, "FAIL\ttestdata/parse_error.mky [syntax error]\n"},
+		{
+			[]string{"test", "testdata/runaway.mky"},
+			1,
+			`--- FAIL: test_loop
+testdata/runaway.mky:3:33: maximum call depth exceeded (100000)
+  let test_loop = fn() { test_loop() };
+                                  ^
+FAIL	testdata/runaway.mky (1 passed, 1 failed)
+`,
+		},
+		{[]string{"test", "-run", "(", "testdata/tests"}, 2, ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+		if code != tt.code {
+			t.Errorf("%v: wrong exit code. expected=%d, got=%d (%s)", tt.args, tt.code, code, stderr.String())
+		}
+		if stdout.String() != tt.expected {
+			t.Errorf("%v: wrong output.\nexpected=%q\ngot=     %q", tt.args, tt.expected, stdout.String())
+		}
+	}
+}
+
+func TestDocCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"doc", "testdata/doc.mky"}, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("wrong exit code. expected=0, got=%d (%s)", code, stderr.String())
+	}
+
+	expected := "# testdata/doc.mky\n\nThings to do with names.\n\n## greet\n\n```\nfn greet(name)\n```\n\ngreet says hello to name.\n"
+	if stdout.String() != expected {
+		t.Errorf("wrong markdown.\nexpected=%q\ngot=     %q", expected, stdout.String())
+	}
+
+	out := filepath.Join(t.TempDir(), "doc.html")
+	stdout.Reset()
+	if code := run([]string{"doc", "-html", "-o", out, "testdata/doc.mky"}, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("-html: wrong exit code. expected=0, got=%d (%s)", code, stderr.String())
+	}
+	page, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.Len() != 0 || !strings.Contains(string(page), `<h2 id="greet">greet</h2>`) {
+		t.Errorf("-html -o: wrong page. got=%q, stdout=%q", page, stdout.String())
+	}
+
+	stderr.Reset()
+	if code := run([]string{"doc", "testdata/parse_error.mky"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("parse error: wrong exit code. expected=2, got=%d", code)
+	}
+	if !strings.HasPrefix(stderr.String(), "testdata/parse_error.mky:") {
+		t.Errorf("parse error: wrong output. got=%q", stderr.String())
+	}
+}
+
+func TestSourceFromStdinAndExpression(t *testing.T) {
+	tests := []struct {
+		args           []string
+		stdin          string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"-e", `len("abc")`}, "", 0, "3\n", ""},
+		{[]string{"run", "-e", `"a" + "b"`}, "", 0, "ab\n", ""},
+		{[]string{"-e", `let x = 1;`}, "", 0, "", ""},
+		{[]string{"-e", `1 + true`}, "", 1, "", "-e:1:3: type mismatch: INTEGER + BOOLEAN\n  1 + true\n    ^\n"},
+		{[]string{"-e", `puts("abc)`}, "", 2, "", "-e:1:6: unterminated string\n"},
+		{[]string{"--tokens", "-e", `x`}, "", 0, "1:1\tIDENT\t\"x\"\n1:2\tEOF\n", ""},
+		{[]string{"-e", `ARGV`}, "", 0, "[]\n", ""},
+		{[]string{"-e", `ARGV`, "a", "b"}, "", 0, "[a, b]\n", ""},
+		{[]string{"-e", `"Hello " + first(ARGV)`, "World", "-n", "3"}, "", 0, "Hello World\n", ""},
+		{[]string{"run", "-", "x"}, "ARGV[0] + 1", 1, "", "<stdin>:1:9: type mismatch: STRING + INTEGER\n"},
+		{[]string{"run", "-"}, "1 + true", 1, "", "<stdin>:1:3: type mismatch: INTEGER + BOOLEAN\n"},
+		{nil, "let x = 1 +\n true", 1, "", "<stdin>:1:11: type mismatch: INTEGER + BOOLEAN\n"},
+		{nil, "let x = 1;", 0, "", ""},
+		// puts writes to the stdout run was given, not os.Stdout
+		{nil, "puts(1 + 2)", 0, "3\n", ""},
+		{[]string{"run", "-", "x"}, "puts(ARGV[0])", 0, "x\n", ""},
+		{[]string{"-e", `puts("hi"); 1`}, "", 0, "hi\n1\n", ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. expected=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("%v: wrong stdout. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+
+		if !strings.HasPrefix(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: wrong stderr. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestPrintDiagnosticTabs(t *testing.T) {
+	var out bytes.Buffer
+
+	printDiagnostic(&out, "f.mky", "let x = 1;\n\t\tx + y\n", 2, 7, "identifier not found: y")
+
+	expected := "f.mky:2:7: identifier not found: y\n" +
+		"  \t\tx + y\n" +
+		"  \t\t    ^\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong diagnostic.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestReplCommand(t *testing.T) {
+	rc := filepath.Join(t.TempDir(), "rc.mky")
+	if err := os.WriteFile(rc, []byte("let three = 3;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("MONKEY_PROMPT", "env> ")
+	t.Setenv("MONKEYRC", rc)
+	t.Setenv("HOME", t.TempDir())
+
+	tests := []struct {
+		args           []string
+		expectedOutput string
+	}{
+		{[]string{"repl"}, "env> 3\nenv> "},
+		{[]string{"repl", "--prompt", "flag> "}, "flag> 3\nflag> "},
+		{[]string{"repl", "--no-rc"}, "env> ERROR: identifier not found: three\nenv> "},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		if code := run(tt.args, strings.NewReader("three\n"), &stdout, &stderr); code != 0 {
+			t.Fatalf("%v: wrong exit code. expected=0, got=%d (%s)", tt.args, code, stderr.String())
+		}
+
+		if !strings.HasSuffix(stdout.String(), tt.expectedOutput) {
+			t.Errorf("%v: wrong output. expected suffix=%q, got=%q", tt.args, tt.expectedOutput, stdout.String())
+		}
+	}
+}
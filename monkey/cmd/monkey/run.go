@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/profile"
+	"monkey/token"
+	"monkey/vm"
+	"os"
+	"runtime"
+)
+
+/*
+runCommand handles `monkey run [flags] <file> [args...]` and returns the process exit
+code: 0 on success, 1 if the file couldn't be read or the program stopped
+with a runtime error, 2 if it didn't lex/parse or the usage was wrong.
+errors go to stderr, formatted by printDiagnostic
+
+the source doesn't have to come from a file:
+  - a file name of - reads the program from stdin
+  - -e 'src' runs src itself and prints the value it evaluates to, so
+    monkey -e 'len("abc")' prints 3
+
+a file that monkey build compiled to bytecode (see buildCommand) runs
+just like a script, straight on the vm
+
+the stage-dump flags show what the interpreter does with the file:
+  - --tokens prints the lexer's output and --ast / --ast-json the parser's,
+    instead of running the program
+  - --trace runs the program and writes every evaluation step to stderr
+
+--engine picks what runs the program: eval (the default) walks the AST,
+vm compiles it to bytecode first and runs that on the virtual machine.
+--stats (vm only) prints what the run allocated afterwards
+
+--profile prints where the time went to stderr after the run (see the
+profile package): calls and time per function, and on the vm how often
+each opcode ran. --profile-out=file writes the same for go tool pprof
+
+other than with -e the value of the last statement isn't printed - scripts
+talk to the outside world through puts. whatever comes after the file name
+(or after -e 'src') is passed to the program as ARGV, an array of strings,
+so `monkey run greet.mky World` can use ARGV[0]. flags have to come before
+the file name, anything after it belongs to the script
+*/
+func runCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey run [flags] <file> [args...]")
+		fmt.Fprintln(stderr, "       monkey run [flags] -e <source> [args...]")
+		flags.PrintDefaults()
+	}
+
+	expr := flags.String("e", "", "run `source` instead of a file and print its value")
+	tokens := flags.Bool("tokens", false, "print the token stream instead of running")
+	dumpAST := flags.Bool("ast", false, "print the parsed AST instead of running")
+	dumpJSON := flags.Bool("ast-json", false, "print the parsed AST as JSON instead of running")
+	trace := flags.Bool("trace", false, "trace evaluation to stderr while running")
+	engine := flags.String("engine", "eval", "what runs the program: `eval` or vm")
+	stats := flags.Bool("stats", false, "print what the vm allocated to stderr after running")
+	profileText := flags.Bool("profile", false, "print calls and time per function to stderr after running")
+	profileOut := flags.String("profile-out", "", "write a profile for go tool pprof to `file` after running")
+
+	if err := flags.Parse(args); err != nil {
+		return exitSyntaxError
+	}
+
+	if *engine != "eval" && *engine != "vm" {
+		fmt.Fprintf(stderr, "monkey: unknown engine %q (want eval or vm)\n", *engine)
+		return exitSyntaxError
+	}
+	if *trace && *engine != "eval" {
+		fmt.Fprintln(stderr, "monkey: --trace only works with --engine=eval")
+		return exitSyntaxError
+	}
+
+	var path string
+	var src []byte
+	var argv []string
+
+	switch {
+	case *expr != "":
+		path = "-e"
+		src = []byte(*expr)
+		argv = flags.Args()
+	case flags.NArg() >= 1:
+		path = flags.Arg(0)
+		argv = flags.Args()[1:]
+
+		var err error
+		if path == "-" {
+			path = "<stdin>"
+			src, err = io.ReadAll(stdin)
+		} else {
+			src, err = os.ReadFile(path)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return exitRuntimeError
+		}
+	default:
+		flags.Usage()
+		return exitSyntaxError
+	}
+
+	if compiler.IsBytecode(src) {
+		if *tokens || *dumpAST || *dumpJSON || *trace {
+			fmt.Fprintf(stderr, "monkey: %s is compiled bytecode, the stage flags need the source\n", path)
+			return exitSyntaxError
+		}
+		prof := newProfile(*profileText, *profileOut, path)
+		code := runBytecode(path, src, argv, *stats, prof, stdout, stderr)
+		return finishProfile(prof, *profileText, *profileOut, code, stderr)
+	}
+
+	if *stats && *engine != "vm" {
+		fmt.Fprintln(stderr, "monkey: --stats only works with --engine=vm")
+		return exitSyntaxError
+	}
+
+	if *tokens {
+		printTokens(stdout, string(src))
+	}
+
+	// --tokens on its own shouldn't need the file to parse
+	if *tokens && !*dumpAST && !*dumpJSON {
+		return exitOK
+	}
+
+	program, code := parseSource(path, string(src), stderr)
+	if code != exitOK {
+		return code
+	}
+
+	if *dumpAST {
+		fmt.Fprint(stdout, ast.Dump(program))
+	}
+
+	if *dumpJSON {
+		json, err := ast.DumpJSON(program)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return exitRuntimeError
+		}
+		fmt.Fprintln(stdout, json)
+	}
+
+	if *tokens || *dumpAST || *dumpJSON {
+		return exitOK
+	}
+
+	var result object.Object
+	prof := newProfile(*profileText, *profileOut, path)
+
+	if *engine == "vm" {
+		result, code = runVM(program, argv, path, string(src), *stats, prof, stdout, stderr)
+	} else {
+		var traceTo io.Writer
+		if *trace {
+			traceTo = stderr
+		}
+		result, code = runEval(program, argv, path, string(src), traceTo, prof, stdout, stderr)
+	}
+	code = finishProfile(prof, *profileText, *profileOut, code, stderr)
+
+	// a program that ends in a let has no value (the vm would still have
+	// the last value it popped lying around)
+	if _, isLet := lastStatement(program).(*ast.LetStatement); isLet {
+		result = nil
+	}
+
+	if code == exitOK && *expr != "" && result != nil && result.Type() != object.NULL_OBJ {
+		fmt.Fprintln(stdout, result.Inspect())
+	}
+
+	return code
+}
+
+// parseSource prints the syntax errors if there are any
+func parseSource(path, src string, stderr io.Writer) (*ast.Program, int) {
+	l := lexer.New(src)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		for _, err := range p.ParseErrors() {
+			printDiagnostic(stderr, path, src, err.Line, err.Column, err.Message)
+		}
+		return nil, exitSyntaxError
+	}
+
+	return program, exitOK
+}
+
+// a .mkyc file always runs on the vm, whatever --engine says
+func runBytecode(path string, data []byte, argv []string, stats bool, prof *profile.Profile, stdout, stderr io.Writer) int {
+	bytecode, err := compiler.Decode(bytes.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s: %s\n", path, err)
+		return exitRuntimeError
+	}
+
+	_, code := executeVM(bytecode, argv, path, "", stats, prof, stdout, stderr)
+	return code
+}
+
+// trace is where to trace evaluation to, nil for nowhere
+func runEval(program *ast.Program, argv []string, path, src string, trace io.Writer, prof *profile.Profile, stdout, stderr io.Writer) (object.Object, int) {
+	env := object.NewEnvironment()
+	env.Set("ARGV", argvArray(argv))
+	env.Set("puts", putsTo(stdout))
+	if trace != nil {
+		env.SetTrace(&object.Trace{Out: trace})
+	}
+	if prof != nil {
+		env.SetProfile(prof)
+	}
+
+	evaluated := evaluator.Eval(program, env)
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		printDiagnostic(stderr, path, src, errObj.Line, errObj.Column, errObj.Message)
+		return nil, exitRuntimeError
+	}
+
+	return evaluated, exitOK
+}
+
+// ARGV is a global like any other, except that it's defined before the
+// program is compiled (always as global 0, see argvGlobal) and set before
+// it runs
+func runVM(program *ast.Program, argv []string, path, src string, stats bool, prof *profile.Profile, stdout, stderr io.Writer) (object.Object, int) {
+	bytecode, code := compileVM(program, path, src, stderr)
+	if code != exitOK {
+		return nil, code
+	}
+	return executeVM(bytecode, argv, path, src, stats, prof, stdout, stderr)
+}
+
+// the global slot of ARGV, in programs compiled here as well as in the
+// .mkyc files monkey build writes
+const argvGlobal = 0
+
+func compileVM(program *ast.Program, path, src string, stderr io.Writer) (*compiler.Bytecode, int) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	symbolTable.Define("ARGV")
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		var compileErr *compiler.Error
+		if errors.As(err, &compileErr) {
+			printDiagnostic(stderr, path, src, compileErr.Line, compileErr.Column, compileErr.Message)
+		} else {
+			printDiagnostic(stderr, path, src, 0, 0, err.Error())
+		}
+		return nil, exitRuntimeError
+	}
+
+	return comp.Bytecode(), exitOK
+}
+
+// src is only used to show the line an error happened on, and is empty
+// when running a .mkyc file. prof is nil when not profiling
+func executeVM(bytecode *compiler.Bytecode, argv []string, path, src string, stats bool, prof *profile.Profile, stdout, stderr io.Writer) (object.Object, int) {
+	globals := make([]object.Object, vm.GlobalsSize)
+	globals[argvGlobal] = argvArray(argv)
+
+	var before runtime.MemStats
+	if stats {
+		runtime.ReadMemStats(&before)
+	}
+
+	machine := vm.NewWithGlobalsState(bytecode, globals)
+	machine.SetBuiltin("puts", putsTo(stdout))
+	if prof != nil {
+		machine.SetProfile(prof)
+	}
+	err := machine.Run()
+
+	if stats {
+		printStats(stderr, machine.Stats(), &before)
+	}
+
+	if err != nil {
+		var vmErr *vm.Error
+		if errors.As(err, &vmErr) {
+			printDiagnostic(stderr, path, src, vmErr.Line, vmErr.Column, vmErr.Message)
+		} else {
+			printDiagnostic(stderr, path, src, 0, 0, err.Error())
+		}
+		return nil, exitRuntimeError
+	}
+
+	return machine.LastPoppedStackElem(), exitOK
+}
+
+/*
+printStats shows the vm's own counts next to what the go runtime saw
+being allocated while the program ran (the vm's setup included):
+
+	vm: 11 calls, 12 frames deep
+	vm: allocated 0 integers (20 cached), 0 strings, 0 arrays, 0 hashes, 1 closures
+	go: 3 allocations, 1024 bytes
+*/
+func printStats(w io.Writer, s vm.Stats, before *runtime.MemStats) {
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	fmt.Fprintf(w, "vm: %d calls, %d frames deep\n", s.Calls, s.MaxFrameDepth)
+	fmt.Fprintf(w, "vm: allocated %d integers (%d cached), %d strings, %d arrays, %d hashes, %d closures\n",
+		s.Integers, s.CachedIntegers, s.Strings, s.Arrays, s.Hashes, s.Closures)
+	fmt.Fprintf(w, "go: %d allocations, %d bytes\n",
+		after.Mallocs-before.Mallocs, after.TotalAlloc-before.TotalAlloc)
+}
+
+func lastStatement(program *ast.Program) ast.Statement {
+	if len(program.Statements) == 0 {
+		return nil
+	}
+	return program.Statements[len(program.Statements)-1]
+}
+
+// the builtin puts writes to os.Stdout, a program run here writes to
+// whatever stdout run was given
+func putsTo(w io.Writer) *object.Builtin {
+	return &object.Builtin{Name: "puts", Fn: func(args ...object.Object) object.Object {
+		for _, arg := range args {
+			fmt.Fprintln(w, arg.Inspect())
+		}
+		return nil
+	}}
+}
+
+func argvArray(argv []string) *object.Array {
+	elements := make([]object.Object, len(argv))
+	for i, arg := range argv {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// one token per line: position, type and (for tokens where it isn't the
+// same as the type) the literal
+func printTokens(out io.Writer, src string) {
+	for _, tok := range lexer.Tokenize(src) {
+		if string(tok.Type) == tok.Literal || tok.Type == token.EOF {
+			fmt.Fprintf(out, "%d:%d\t%s\n", tok.Line, tok.Column, tok.Type)
+		} else {
+			fmt.Fprintf(out, "%d:%d\t%s\t%q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// nil unless --profile or --profile-out asked for one
+func newProfile(text bool, out, path string) *profile.Profile {
+	if !text && out == "" {
+		return nil
+	}
+	prof := profile.New()
+	prof.File = path
+	return prof
+}
+
+// finishProfile writes the profile once the program is done, whatever
+// code it finished with - a program that failed halfway has a profile too
+func finishProfile(prof *profile.Profile, text bool, out string, code int, stderr io.Writer) int {
+	if prof == nil {
+		return code
+	}
+	prof.Stop()
+
+	if text {
+		prof.WriteText(stderr)
+	}
+
+	if out != "" {
+		f, err := os.Create(out)
+		if err == nil {
+			err = prof.WritePprof(f)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return max(code, exitRuntimeError)
+		}
+	}
+
+	return code
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+/*
+testCommand runs the tests in *_test.mky files, the way go test does for
+go:
+
+	monkey test                   every *_test.mky under the current directory
+	monkey test dir file.mky      the ones under dir, and file.mky whatever it's called
+	monkey test -run add          only the tests with add in their name
+	monkey test -v                also lists the tests that passed
+	monkey test -parallel 4       runs up to 4 tests at the same time
+
+a test is a top-level let of a function with no parameters whose name
+starts with test_, and it fails if calling it is an error - which is what
+assert and assert_eq are for:
+
+	let test_add = fn() {
+		assert_eq(add(1, 2), 3);
+	};
+
+every test gets the file to itself: the file runs again in a new
+environment before each one, so nothing one test does can leak into the
+next, whatever order they run in. they run on the evaluator, with calls
+nesting at most maxTestDepth deep, and puts still writes straight to
+stdout
+
+a failed test is reported with where it failed, then each file with how
+many of its tests passed. the exit code is 1 if any failed, and 2 if a
+file doesn't parse
+*/
+func testCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey test [flags] [file or dir...]")
+		flags.PrintDefaults()
+	}
+
+	pattern := flags.String("run", "", "only run the tests whose names match `regexp`")
+	verbose := flags.Bool("v", false, "list every test, not just the ones that failed")
+	parallel := flags.Int("parallel", 1, "run up to `n` tests at the same time")
+
+	if err := flags.Parse(args); err != nil {
+		return exitSyntaxError
+	}
+	match, err := regexp.Compile(*pattern)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: -run: %s\n", err)
+		return exitSyntaxError
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	code := exitOK
+	var files []*testFile
+
+	for _, path := range paths {
+		found, err := findTestFiles(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			code = max(code, exitRuntimeError)
+		}
+
+		for _, p := range found {
+			src, err := os.ReadFile(p)
+			if err != nil {
+				fmt.Fprintf(stderr, "monkey: %s\n", err)
+				code = max(code, exitRuntimeError)
+				continue
+			}
+
+			program, c := parseSource(p, string(src), stderr)
+			if c != exitOK {
+				fmt.Fprintf(stdout, "FAIL\t%s [syntax error]\n", p)
+				code = exitSyntaxError
+				continue
+			}
+			files = append(files, newTestFile(p, string(src), program, match))
+		}
+	}
+
+	runTests(files, max(*parallel, 1))
+
+	passed, failed := 0, 0
+	for _, f := range files {
+		for _, t := range f.tests {
+			if t.failure != nil {
+				fmt.Fprintf(stdout, "--- FAIL: %s\n", t.name)
+				printDiagnostic(stdout, f.path, f.src, t.failure.Line, t.failure.Column, t.failure.Message)
+				failed++
+				continue
+			}
+			if *verbose {
+				fmt.Fprintf(stdout, "--- PASS: %s\n", t.name)
+			}
+			passed++
+		}
+		fmt.Fprintln(stdout, f.summary())
+	}
+
+	if failed > 0 && code == exitOK {
+		code = exitRuntimeError
+	}
+	if len(files) > 1 {
+		fmt.Fprintf(stdout, "%d passed, %d failed\n", passed, failed)
+	}
+	return code
+}
+
+// a path named on the command line is a test file whatever it's called,
+// the ones found in a directory only if they end in _test.mky
+func findTestFiles(path string) ([]string, error) {
+	var found []string
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (p != path && !strings.HasSuffix(p, "_test.mky")) {
+			return nil
+		}
+		found = append(found, p)
+		return nil
+	})
+
+	return found, err
+}
+
+type testFile struct {
+	path    string
+	src     string
+	program *ast.Program
+	tests   []*testCase
+}
+
+type testCase struct {
+	name    string
+	let     *ast.LetStatement
+	failure *object.Error // nil if it passed
+}
+
+func newTestFile(path, src string, program *ast.Program, match *regexp.Regexp) *testFile {
+	f := &testFile{path: path, src: src, program: program}
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, "test_") || !match.MatchString(let.Name.Value) {
+			continue
+		}
+		if fn, ok := let.Value.(*ast.FunctionLiteral); !ok || len(fn.Parameters) != 0 {
+			continue
+		}
+		f.tests = append(f.tests, &testCase{name: let.Name.Value, let: let})
+	}
+
+	return f
+}
+
+func (f *testFile) summary() string {
+	var passed, failed int
+	for _, t := range f.tests {
+		if t.failure != nil {
+			failed++
+		} else {
+			passed++
+		}
+	}
+
+	switch {
+	case len(f.tests) == 0:
+		return fmt.Sprintf("ok  \t%s [no tests]", f.path)
+	case failed > 0:
+		return fmt.Sprintf("FAIL\t%s (%d passed, %d failed)", f.path, passed, failed)
+	default:
+		return fmt.Sprintf("ok  \t%s (%d passed)", f.path, passed)
+	}
+}
+
+// runTests runs every test of every file, n at a time. everything the
+// evaluator keeps while it runs is in the environment, so the tests don't
+// get in each other's way
+func runTests(files []*testFile, n int) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, n)
+
+	for _, f := range files {
+		for _, t := range f.tests {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func() {
+				defer wg.Done()
+				t.failure = f.run(t)
+				<-slots
+			}()
+		}
+	}
+
+	wg.Wait()
+}
+
+/*
+maxTestDepth is how deep calls can nest in a test. a test that recurses
+forever would otherwise take the whole runner down with a Go stack
+overflow, and every other test's result with it - this way it's just that
+test that fails. it's far more than any recursion a test means to do
+*/
+const maxTestDepth = 100000
+
+// run runs the whole file in a new environment and then the test, as if
+// the file ended with a call to it
+func (f *testFile) run(t *testCase) *object.Error {
+	env := object.NewEnvironment()
+	env.SetLimits(&object.Limits{MaxDepth: maxTestDepth})
+	env.Set("ARGV", argvArray(nil))
+
+	if errObj, ok := evaluator.Eval(f.program, env).(*object.Error); ok {
+		return errObj
+	}
+
+	call := &ast.CallExpression{Token: t.let.Token, Function: t.let.Name}
+	errObj, _ := evaluator.Eval(call, env).(*object.Error)
+	return errObj
+}
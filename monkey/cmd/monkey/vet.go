@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/vet"
+	"os"
+)
+
+/*
+vetCommand runs the vet package's rules over scripts:
+
+	monkey vet file.mky...              every rule
+	monkey vet -shadow=false file.mky   every rule but shadow
+	monkey vet -unused file.mky         only unused (naming rules picks them)
+	monkey vet -json file.mky           the findings as JSON, on stdout
+
+like go vet, the findings go to stderr - the usual file:line:column
+diagnostics with the rule's name after the message - and the exit code
+is 1 if there were any. -json prints one array with all of them (and the
+syntax errors, as rule "syntax") instead
+*/
+func vetCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("vet", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey vet [flags] <file>...")
+		flags.PrintDefaults()
+	}
+
+	asJSON := flags.Bool("json", false, "print the findings as JSON")
+	enabled := map[string]*bool{}
+	for _, r := range vet.Rules {
+		enabled[r.Name] = flags.Bool(r.Name, true, r.Doc)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return exitSyntaxError
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitSyntaxError
+	}
+
+	rules := selectRules(flags, enabled)
+
+	code := exitOK
+	findings := []vetFinding{}
+
+	for _, path := range flags.Args() {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			code = max(code, exitRuntimeError)
+			continue
+		}
+
+		diags, parseErrors := vet.Source(string(src), rules)
+		if len(diags) > 0 {
+			code = max(code, exitRuntimeError)
+		}
+		if len(parseErrors) > 0 {
+			code = exitSyntaxError
+		}
+
+		if *asJSON {
+			for _, d := range diags {
+				findings = append(findings, vetFinding{File: path, Diagnostic: d})
+			}
+			for _, err := range parseErrors {
+				findings = append(findings, vetFinding{File: path, Diagnostic: vet.Diagnostic{
+					Rule: "syntax", Line: err.Line, Column: err.Column, Message: err.Message,
+				}})
+			}
+			continue
+		}
+
+		for _, d := range diags {
+			printDiagnostic(stderr, path, string(src), d.Line, d.Column, d.Message+" ("+d.Rule+")")
+		}
+		for _, err := range parseErrors {
+			printDiagnostic(stderr, path, string(src), err.Line, err.Column, err.Message)
+		}
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(findings, "", "\t")
+		fmt.Fprintln(stdout, string(out))
+	}
+
+	return code
+}
+
+type vetFinding struct {
+	File string `json:"file"`
+	vet.Diagnostic
+}
+
+// every rule runs unless some were asked for by name (-unused, or
+// -unused=true), and then only those do. -rule=false leaves one out
+func selectRules(flags *flag.FlagSet, enabled map[string]*bool) []*vet.Rule {
+	only := false
+	flags.Visit(func(f *flag.Flag) {
+		if on, ok := enabled[f.Name]; ok && *on {
+			only = true
+		}
+	})
+
+	var rules []*vet.Rule
+	for _, r := range vet.Rules {
+		if !*enabled[r.Name] {
+			continue
+		}
+		if only {
+			asked := false
+			flags.Visit(func(f *flag.Flag) { asked = asked || f.Name == r.Name })
+			if !asked {
+				continue
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
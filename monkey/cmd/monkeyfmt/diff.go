@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lines of context around each change, like diff -u
+const context = 3
+
+type edit struct {
+	op   byte // ' ' for a line both have, '-' for one only in a, '+' only in b
+	text string
+}
+
+/*
+diff returns the hunks of a unified diff from a to b (without the ---
+and +++ lines). it finds the longest common subsequence of lines the
+simple way, in a table. that's fine here since formatting changes little:
+the lines the two have in common at the start and end are taken off
+first, and what's left is small
+*/
+func diff(a, b string) string {
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	for start := 0; start < len(edits); {
+		// the next change, and the lines of context before it
+		first := start
+		for first < len(edits) && edits[first].op == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		from := max(first-context, start)
+
+		// changes with less than twice the context between them go in the
+		// same hunk
+		last := first
+		for i := first; i < len(edits) && i-last <= 2*context; i++ {
+			if edits[i].op != ' ' {
+				last = i
+			}
+		}
+		to := min(last+context+1, len(edits))
+
+		writeHunk(&out, edits, from, to)
+		start = to
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, edits []edit, from, to int) {
+	// the line numbers the hunk starts at in a and b
+	aLine, bLine := 1, 1
+	for _, e := range edits[:from] {
+		if e.op != '+' {
+			aLine++
+		}
+		if e.op != '-' {
+			bLine++
+		}
+	}
+
+	aLen, bLen := 0, 0
+	for _, e := range edits[from:to] {
+		if e.op != '+' {
+			aLen++
+		}
+		if e.op != '-' {
+			bLen++
+		}
+	}
+
+	// an empty side is numbered by the line before it
+	if aLen == 0 {
+		aLine--
+	}
+	if bLen == 0 {
+		bLine--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aLine, aLen, bLine, bLen)
+	for _, e := range edits[from:to] {
+		out.WriteByte(e.op)
+		out.WriteString(e.text)
+		if !strings.HasSuffix(e.text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// splitLines keeps the newlines, so a last line without one can be told
+// apart
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func diffLines(a, b []string) []edit {
+	var prefix, suffix []edit
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, edit{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]edit{{' ', a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	edits := prefix
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	return append(edits, suffix...)
+}
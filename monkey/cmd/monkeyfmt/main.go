@@ -0,0 +1,150 @@
+/*
+monkeyfmt formats monkey programs (see the format package for the style),
+the way gofmt does go:
+
+	monkeyfmt                  formats stdin to stdout
+	monkeyfmt file.mky dir     prints the formatted files, and every .mky under dir
+	monkeyfmt -w file.mky      rewrites the files that aren't formatted yet
+	monkeyfmt -d file.mky      prints a diff for each file that isn't, and nothing else
+
+-w and -d go together, too. a file that doesn't parse is left alone and
+its errors printed; the exit code is 2 then, 1 if a file couldn't be read
+or written
+*/
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"monkey/format"
+	"os"
+	"path/filepath"
+)
+
+const (
+	exitOK          = 0
+	exitIOError     = 1
+	exitSyntaxError = 2 // and bad command line usage
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+type options struct {
+	write bool
+	diff  bool
+}
+
+// run is main without the os.Exit, for the tests
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkeyfmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkeyfmt [-w] [-d] [path ...]")
+		flags.PrintDefaults()
+	}
+
+	var opts options
+	flags.BoolVar(&opts.write, "w", false, "write the result back to the file instead of printing it")
+	flags.BoolVar(&opts.diff, "d", false, "print a diff instead of the formatted source")
+
+	if err := flags.Parse(args); err != nil {
+		return exitSyntaxError
+	}
+
+	if flags.NArg() == 0 {
+		if opts.write {
+			fmt.Fprintln(stderr, "monkeyfmt: can't use -w on stdin")
+			return exitSyntaxError
+		}
+		src, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkeyfmt: %s\n", err)
+			return exitIOError
+		}
+		return formatFile("<stdin>", src, 0, opts, stdout, stderr)
+	}
+
+	code := exitOK
+	for _, path := range flags.Args() {
+		c := formatPath(path, opts, stdout, stderr)
+		code = max(code, c)
+	}
+	return code
+}
+
+// formatPath formats a file, or every .mky file in a directory tree
+func formatPath(path string, opts options, stdout, stderr io.Writer) int {
+	code := exitOK
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// files named on the command line are formatted whatever they're
+		// called, the ones found in a directory only if they're monkey
+		if d.IsDir() || (p != path && filepath.Ext(p) != ".mky") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		src, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		code = max(code, formatFile(p, src, info.Mode().Perm(), opts, stdout, stderr))
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "monkeyfmt: %s\n", err)
+		code = max(code, exitIOError)
+	}
+
+	return code
+}
+
+func formatFile(path string, src []byte, perm fs.FileMode, opts options, stdout, stderr io.Writer) int {
+	out, err := format.Source(src)
+	if err != nil {
+		var formatErr *format.Error
+		if !errors.As(err, &formatErr) {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			return exitSyntaxError
+		}
+		for _, e := range formatErr.Errors {
+			fmt.Fprintf(stderr, "%s:%d:%d: %s\n", path, e.Line, e.Column, e.Message)
+		}
+		return exitSyntaxError
+	}
+
+	changed := !bytes.Equal(src, out)
+
+	if opts.diff && changed {
+		fmt.Fprintf(stdout, "diff %s.orig %s\n", path, path)
+		fmt.Fprintf(stdout, "--- %s.orig\n+++ %s\n", path, path)
+		io.WriteString(stdout, diff(string(src), string(out)))
+	}
+
+	if opts.write {
+		if changed {
+			if err := os.WriteFile(path, out, perm); err != nil {
+				fmt.Fprintf(stderr, "monkeyfmt: %s\n", err)
+				return exitIOError
+			}
+		}
+		return exitOK
+	}
+
+	if !opts.diff {
+		stdout.Write(out)
+	}
+	return exitOK
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStdin(t *testing.T) {
+	tests := []struct {
+		args           []string
+		input          string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{nil, "let x=1\nputs(x)", 0, "let x = 1;\nputs(x);\n", ""},
+		{[]string{"-d"}, "let x = 1;\n", 0, "", ""},
+		{nil, "let = 1;", 2, "", "<stdin>:1:5: expected next token to be IDENT, got = instead\n"},
+		{[]string{"-w"}, "let x = 1;", 2, "", "monkeyfmt: can't use -w on stdin\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := run(tt.args, strings.NewReader(tt.input), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("%v %q: wrong exit code. expected=%d, got=%d", tt.args, tt.input, tt.expectedCode, code)
+		}
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("%v %q: wrong stdout. expected=%q, got=%q", tt.args, tt.input, tt.expectedStdout, stdout.String())
+		}
+		if !strings.HasPrefix(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v %q: wrong stderr. expected=%q, got=%q", tt.args, tt.input, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy.mky")
+	tidy := filepath.Join(dir, "sub", "tidy.mky")
+	other := filepath.Join(dir, "notes.txt")
+
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(messy, []byte("let x=1 // one\nx+1"), 0644)
+	os.WriteFile(tidy, []byte("let y = 2;\n"), 0644)
+	os.WriteFile(other, []byte("not monkey"), 0644)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-w", dir}, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("wrong exit code. expected=0, got=%d (%s)", code, stderr.String())
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("-w printed something: %q", stdout.String())
+	}
+
+	expected := map[string]string{
+		messy: "let x = 1; // one\nx + 1;\n",
+		tidy:  "let y = 2;\n",
+		other: "not monkey",
+	}
+	for path, want := range expected {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading %s: %s", path, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: expected=%q, got=%q", filepath.Base(path), want, got)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\nc\n", "a\nB\nc\n", "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"a\n", "a\nb\n", "@@ -1,1 +1,2 @@\n a\n+b\n"},
+		{"", "a\n", "@@ -0,0 +1,1 @@\n+a\n"},
+		{"a", "a\n", "@@ -1,1 +1,1 @@\n-a\n\\ No newline at end of file\n+a\n"},
+		{
+			// changes far enough apart get a hunk each
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			"one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got := diff(tt.a, tt.b)
+		if got != tt.expected {
+			t.Errorf("diff(%q, %q) wrong.\nexpected=%q\ngot=     %q", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
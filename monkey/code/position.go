@@ -0,0 +1,37 @@
+package code
+
+/*
+the compiler throws the AST away, so without some help a runtime error in
+the vm could only say *what* went wrong and not *where*. a PositionTable
+is the help: for every instruction that can fail, the line and column of
+the node it was compiled from
+
+entries are added in order of Offset as the instructions are emitted, so
+the table is sorted and Lookup can search it
+*/
+type Position struct {
+	Offset int // of the instruction in its Instructions
+	Line   int
+	Column int
+}
+
+type PositionTable []Position
+
+// Lookup returns the position of the instruction at offset, or of the
+// nearest instruction before it that has one. line is 0 if there is none
+func (pt PositionTable) Lookup(offset int) (line, column int) {
+	lo, hi := 0, len(pt)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if pt[mid].Offset <= offset {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	if lo == 0 {
+		return 0, 0
+	}
+	return pt[lo-1].Line, pt[lo-1].Column
+}
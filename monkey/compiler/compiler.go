@@ -0,0 +1,647 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+)
+
+/*
+the compiler walks the AST like the evaluator does, but instead of
+computing values it emits the instructions that will compute them once
+the vm runs them. literals that can't be encoded as operands (integers,
+strings, functions) go into the constant pool and get loaded by index
+
+every function literal is compiled in a scope of its own, so its
+instructions end up in a CompiledFunction rather than in the middle of
+the code that defines it
+
+once a function is done, its instructions go through the passes in
+optimize.go, which take out the code that can't ever run
+
+the one difference from the evaluator is that names are resolved while
+compiling instead of while running, so using a name that hasn't been
+defined yet is an error up front - even inside a function that would
+only be called after the definition
+*/
+type Compiler struct {
+	constants []object.Object
+
+	// where each integer and string already is in constants, so the same
+	// literal used twice only gets one entry
+	constantIndexes map[constantKey]int
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// the first operand that didn't fit into its instruction, see emit
+	err *Error
+}
+
+// the instructions of one function (or the main program) as they're
+// being emitted
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    code.PositionTable
+
+	// the last two instructions, so that e.g. the OpPop at the end of an
+	// if's branch can be taken back out
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// Bytecode is what the compiler hands over to the vm
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    code.PositionTable
+	Constants    []object.Object
+}
+
+// Error is a compile error, with the position of the node that caused it
+type Error struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return NewWithState(symbolTable, []object.Object{})
+}
+
+// NewWithState lets the caller pass in a symbol table (and constants) that
+// something else already put names into, e.g. a global it sets up itself
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	c := &Compiler{
+		constants:       constants,
+		constantIndexes: make(map[constantKey]int),
+		symbolTable:     s,
+		scopes:          []CompilationScope{mainScope},
+		scopeIndex:      0,
+	}
+
+	for i, obj := range constants {
+		if key, ok := keyFor(obj); ok {
+			if _, seen := c.constantIndexes[key]; !seen {
+				c.constantIndexes[key] = i
+			}
+		}
+	}
+
+	return c
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+
+	// statements
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	// the name is only defined once the value is compiled, which keeps
+	// let x = x an error instead of reading a slot that was never set. a
+	// function can still call itself, see DefineFunctionName
+	case *ast.LetStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	// expressions
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		c.mark(node.Token)
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return errorAt(node.Token, "unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return errorAt(node.Token, "unknown operator %s", node.Operator)
+		}
+		c.mark(node.Token)
+		c.emit(op)
+
+	/*
+		both branches have to leave exactly one value behind, since the if
+		is an expression. a branch that ends in an expression statement
+		gets its OpPop taken out so the value stays on the stack; one that
+		doesn't (an empty block, or one ending in a let) pushes null. a
+		missing else is the same as an else that pushes null
+	*/
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		// the jump targets aren't known yet, 9999 gets patched later
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBranch(node.Consequence); err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			if err := c.compileBranch(node.Alternative); err != nil {
+				return err
+			}
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return errorAt(node.Token, "identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	// keys and values go onto the stack in pairs, in source order
+	case *ast.HashLiteral:
+		for _, k := range node.Keys {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+
+		c.mark(node.Token)
+		c.emit(code.OpHash, len(node.Keys)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+
+		c.mark(node.Token)
+		c.emit(code.OpIndex)
+
+	/*
+		the function is compiled in its own scope, and whatever it used from
+		the enclosing functions comes out of that as its free symbols. those
+		get loaded (in the enclosing scope) right before the OpClosure that
+		bundles them up with the function
+	*/
+	case *ast.FunctionLiteral:
+		c.enterScope()
+
+		if node.Name != "" {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
+
+		for _, p := range node.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
+
+		if err := c.Compile(node.Body); err != nil {
+			return err
+		}
+
+		// the value of the last expression statement is the return value
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		instructions, positions := c.leaveScope()
+
+		for _, s := range freeSymbols {
+			c.loadSymbol(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			Positions:     positions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			Line:          node.Body.Token.Line,
+		}
+		c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+
+		c.mark(node.Token)
+		c.emit(code.OpCall, len(node.Arguments))
+	}
+
+	if c.err != nil {
+		// the innermost node gets to say where, like in the evaluator
+		if c.err.Line == 0 {
+			c.err.Line, c.err.Column = positionOf(node)
+		}
+		return c.err
+	}
+	return nil
+}
+
+// the nodes that compile to instructions with operands, which are the
+// ones that can run out of room in them
+func positionOf(node ast.Node) (int, int) {
+	var tok token.Token
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		tok = node.Token
+	case *ast.Identifier:
+		tok = node.Token
+	case *ast.IntegerLiteral:
+		tok = node.Token
+	case *ast.StringLiteral:
+		tok = node.Token
+	case *ast.IfExpression:
+		tok = node.Token
+	case *ast.ArrayLiteral:
+		tok = node.Token
+	case *ast.HashLiteral:
+		tok = node.Token
+	case *ast.FunctionLiteral:
+		tok = node.Token
+	case *ast.CallExpression:
+		tok = node.Token
+	}
+	return tok.Line, tok.Column
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+}
+
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// the main program is optimized here rather than as it's compiled, since
+// it's only finished once the caller asks for the bytecode
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[c.scopeIndex]
+	instructions, positions := optimize(scope.instructions, scope.positions, c.constants)
+
+	return &Bytecode{
+		Instructions: instructions,
+		Positions:    positions,
+		Constants:    c.constants,
+	}
+}
+
+/*
+addConstant returns the index of obj in the constant pool. integers and
+strings that are already in there are reused: they're immutable, so every
+place that uses the literal can share one object. functions always get an
+entry of their own
+*/
+func (c *Compiler) addConstant(obj object.Object) int {
+	key, dedupe := keyFor(obj)
+	if dedupe {
+		if index, ok := c.constantIndexes[key]; ok {
+			return index
+		}
+	}
+
+	c.constants = append(c.constants, obj)
+	index := len(c.constants) - 1
+
+	if dedupe {
+		c.constantIndexes[key] = index
+	}
+	return index
+}
+
+type constantKey struct {
+	typ     object.ObjectType
+	integer int64
+	str     string
+}
+
+func keyFor(obj object.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return constantKey{typ: obj.Type(), integer: obj.Value}, true
+	case *object.String:
+		return constantKey{typ: obj.Type(), str: obj.Value}, true
+	default:
+		return constantKey{}, false
+	}
+}
+
+/*
+emit adds an instruction to the current scope and returns its position.
+an operand that's too big for its instruction - the 257th local, say,
+whose index doesn't fit in a byte - would come out cut down to whatever
+does fit and quietly mean something else, so it's a compile error
+instead, which Compile returns once it's done with the node
+*/
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// mark records tok's position for the next instruction, which has to be
+// one that can fail while running - those are the only ones the vm ever
+// needs a position for
+func (c *Compiler) mark(tok token.Token) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.positions = append(scope.positions, code.Position{
+		Offset: len(scope.instructions),
+		Line:   tok.Line,
+		Column: tok.Column,
+	})
+}
+
+func errorAt(tok token.Token, format string, a ...interface{}) error {
+	return &Error{Message: fmt.Sprintf(format, a...), Line: tok.Line, Column: tok.Column}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// changeOperand is only ever used on instructions with a single operand
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, []int{operand})
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() (code.Instructions, code.PositionTable) {
+	scope := c.scopes[c.scopeIndex]
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return optimize(scope.instructions, scope.positions, c.constants)
+}
+
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+
+	for i, o := range operands {
+		if i >= len(def.OperandWidths) {
+			break
+		}
+		limit := 1 << (8 * def.OperandWidths[i])
+		if o < 0 || o >= limit {
+			what, most := tooMany(op, i, limit)
+			c.err = &Error{Message: fmt.Sprintf("too many %s (the most there can be is %d)", what, most)}
+			return
+		}
+	}
+}
+
+/*
+tooMany says what there are too many of for operand i of op to hold, and
+how many there can be. an index into something fits limit of them, a count
+of things one less, since the count can be 0 too
+*/
+func tooMany(op code.Opcode, operand int, limit int) (string, int) {
+	switch op {
+	case code.OpConstant:
+		return "constants", limit
+	case code.OpClosure:
+		if operand == 0 {
+			return "constants", limit
+		}
+		return "free variables in a function", limit - 1
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return "globals", limit
+	case code.OpGetLocal, code.OpSetLocal:
+		return "locals in a function", limit
+	case code.OpGetFree:
+		return "free variables in a function", limit
+	case code.OpCall:
+		return "arguments", limit - 1
+	case code.OpArray:
+		return "elements in an array", limit - 1
+	case code.OpHash:
+		// the operand counts the keys and the values
+		return "pairs in a hash", (limit - 1) / 2
+	case code.OpJump, code.OpJumpNotTruthy:
+		return "instructions to jump across", limit - 1
+	default:
+		def, _ := code.Lookup(byte(op))
+		return "operands to " + def.Name, limit - 1
+	}
+}
@@ -0,0 +1,259 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/code"
+	"monkey/object"
+)
+
+/*
+Encode and Decode turn Bytecode into bytes and back, which is what .mkyc
+files are: a program that's already been compiled, so running it doesn't
+need the lexer, parser or compiler any more
+
+the layout, with every number a big endian uint32 unless it says otherwise:
+
+	"MKYC"                 magic, so we don't try to run some random file
+	version                uint16, see BytecodeVersion
+	instructions           length, then the bytes
+	positions              count, then offset/line/column for each
+	constants              count, then for each a one byte tag and:
+	  'i' integer            int64
+	  's' string             length, then the bytes
+	  'f' compiled function  instructions, positions, NumLocals, NumParameters,
+	                         the Name (length, then the bytes) and Line
+
+the vm only understands the opcodes of the compiler it was built with, so
+BytecodeVersion has to go up whenever an opcode or this layout changes -
+files with a different version are refused instead of misread
+*/
+const BytecodeVersion = 2
+
+var Magic = []byte("MKYC")
+
+const (
+	tagInteger  = 'i'
+	tagString   = 's'
+	tagFunction = 'f'
+)
+
+func Encode(w io.Writer, b *Bytecode) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+
+	e.bytes(Magic)
+	e.uint16(BytecodeVersion)
+	e.instructions(b.Instructions)
+	e.positions(b.Positions)
+
+	e.uint32(len(b.Constants))
+	for _, c := range b.Constants {
+		e.constant(c)
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// encoder remembers the first error, so the methods can be called one
+// after another without checking every one of them
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *encoder) bytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) uint16(n int) {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], uint16(n))
+	e.bytes(buf[:])
+}
+
+func (e *encoder) uint32(n int) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(n))
+	e.bytes(buf[:])
+}
+
+func (e *encoder) int64(n int64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	e.bytes(buf[:])
+}
+
+func (e *encoder) instructions(ins code.Instructions) {
+	e.uint32(len(ins))
+	e.bytes(ins)
+}
+
+func (e *encoder) positions(pt code.PositionTable) {
+	e.uint32(len(pt))
+	for _, p := range pt {
+		e.uint32(p.Offset)
+		e.uint32(p.Line)
+		e.uint32(p.Column)
+	}
+}
+
+func (e *encoder) constant(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.bytes([]byte{tagInteger})
+		e.int64(obj.Value)
+	case *object.String:
+		e.bytes([]byte{tagString})
+		e.uint32(len(obj.Value))
+		e.bytes([]byte(obj.Value))
+	case *object.CompiledFunction:
+		e.bytes([]byte{tagFunction})
+		e.instructions(obj.Instructions)
+		e.positions(obj.Positions)
+		e.uint32(obj.NumLocals)
+		e.uint32(obj.NumParameters)
+		e.uint32(len(obj.Name))
+		e.bytes([]byte(obj.Name))
+		e.uint32(obj.Line)
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("can't encode constant of type %s", obj.Type())
+		}
+	}
+}
+
+// ErrNotBytecode is returned by Decode for input that doesn't start with
+// the magic header
+var ErrNotBytecode = errors.New("not a monkey bytecode file")
+
+// IsBytecode reports whether data starts like an encoded program
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, Magic)
+}
+
+func Decode(r io.Reader) (*Bytecode, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	magic := d.bytes(len(Magic))
+	if d.err != nil || !bytes.Equal(magic, Magic) {
+		return nil, ErrNotBytecode
+	}
+
+	if version := d.uint16(); d.err == nil && version != BytecodeVersion {
+		return nil, fmt.Errorf("bytecode version %d isn't supported (want %d), rebuild it from the source",
+			version, BytecodeVersion)
+	}
+
+	b := &Bytecode{}
+	b.Instructions = d.instructions()
+	b.Positions = d.positions()
+
+	count := d.uint32()
+	for i := 0; i < count && d.err == nil; i++ {
+		b.Constants = append(b.Constants, d.constant())
+	}
+
+	if d.err == nil {
+		d.err = verify(b)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("corrupt bytecode: %w", d.err)
+	}
+	return b, nil
+}
+
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+// lengths come straight from the file, so they're checked against what's
+// actually left instead of being trusted with an allocation
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	var out bytes.Buffer
+	if _, err := io.CopyN(&out, d.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		d.err = err
+		return nil
+	}
+	return out.Bytes()
+}
+
+func (d *decoder) uint16() int {
+	b := d.bytes(2)
+	if d.err != nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) uint32() int {
+	b := d.bytes(4)
+	if d.err != nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) int64() int64 {
+	b := d.bytes(8)
+	if d.err != nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (d *decoder) instructions() code.Instructions {
+	return code.Instructions(d.bytes(d.uint32()))
+}
+
+func (d *decoder) positions() code.PositionTable {
+	count := d.uint32()
+
+	pt := code.PositionTable{}
+	for i := 0; i < count && d.err == nil; i++ {
+		pt = append(pt, code.Position{Offset: d.uint32(), Line: d.uint32(), Column: d.uint32()})
+	}
+	return pt
+}
+
+func (d *decoder) constant() object.Object {
+	tag := d.bytes(1)
+	if d.err != nil {
+		return nil
+	}
+
+	switch tag[0] {
+	case tagInteger:
+		return &object.Integer{Value: d.int64()}
+	case tagString:
+		return &object.String{Value: string(d.bytes(d.uint32()))}
+	case tagFunction:
+		return &object.CompiledFunction{
+			Instructions:  d.instructions(),
+			Positions:     d.positions(),
+			NumLocals:     d.uint32(),
+			NumParameters: d.uint32(),
+			Name:          string(d.bytes(d.uint32())),
+			Line:          d.uint32(),
+		}
+	default:
+		d.err = fmt.Errorf("unknown constant tag %q", tag[0])
+		return nil
+	}
+}
@@ -0,0 +1,149 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	inputs := []string{
+		`1 + 2; "monkey"`,
+		`let add = fn(a, b) { let c = a + b; c }; add(1, 2) * -3`,
+		`let f = fn(x) { fn(y) { x + y } }; f(1)(2)`,
+		`[1, 2, 3][1]; {"a": true}["a"]`,
+		``,
+	}
+
+	for _, input := range inputs {
+		comp := New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", input, err)
+		}
+		bytecode := comp.Bytecode()
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, bytecode); err != nil {
+			t.Fatalf("%q: encode error: %s", input, err)
+		}
+
+		if !IsBytecode(buf.Bytes()) {
+			t.Errorf("%q: encoded program doesn't start with the magic header", input)
+		}
+
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("%q: decode error: %s", input, err)
+		}
+
+		if decoded.Instructions.String() != bytecode.Instructions.String() {
+			t.Errorf("%q: wrong instructions.\nwant=%s\ngot=%s",
+				input, bytecode.Instructions, decoded.Instructions)
+		}
+		if err := testSamePositions(bytecode.Positions, decoded.Positions); err != nil {
+			t.Errorf("%q: %s", input, err)
+		}
+		if len(decoded.Constants) != len(bytecode.Constants) {
+			t.Fatalf("%q: wrong number of constants. want=%d, got=%d",
+				input, len(bytecode.Constants), len(decoded.Constants))
+		}
+		for i, c := range bytecode.Constants {
+			if err := testSameConstant(c, decoded.Constants[i]); err != nil {
+				t.Errorf("%q: constant %d wrong: %s", input, i, err)
+			}
+		}
+	}
+}
+
+// functions Inspect as their address, so these get compared field by field
+func testSameConstant(expected, actual object.Object) error {
+	fn, ok := expected.(*object.CompiledFunction)
+	if !ok {
+		if actual.Type() != expected.Type() || actual.Inspect() != expected.Inspect() {
+			return fmt.Errorf("want=%s, got=%s", expected.Inspect(), actual.Inspect())
+		}
+		return nil
+	}
+
+	got, ok := actual.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function. got=%T (%+v)", actual, actual)
+	}
+	if got.Instructions.String() != fn.Instructions.String() {
+		return fmt.Errorf("wrong instructions.\nwant=%s\ngot=%s", fn.Instructions, got.Instructions)
+	}
+	if got.NumLocals != fn.NumLocals || got.NumParameters != fn.NumParameters {
+		return fmt.Errorf("wrong NumLocals/NumParameters. want=%d/%d, got=%d/%d",
+			fn.NumLocals, fn.NumParameters, got.NumLocals, got.NumParameters)
+	}
+	if got.Name != fn.Name || got.Line != fn.Line {
+		return fmt.Errorf("wrong Name/Line. want=%q/%d, got=%q/%d", fn.Name, fn.Line, got.Name, got.Line)
+	}
+	return testSamePositions(fn.Positions, got.Positions)
+}
+
+func testSamePositions(expected, actual code.PositionTable) error {
+	if len(actual) != len(expected) {
+		return fmt.Errorf("wrong number of positions. want=%d, got=%d", len(expected), len(actual))
+	}
+	for i, p := range expected {
+		if actual[i] != p {
+			return fmt.Errorf("wrong position %d. want=%+v, got=%+v", i, p, actual[i])
+		}
+	}
+	return nil
+}
+
+func TestDecodeErrors(t *testing.T) {
+	comp := New()
+	if err := comp.Compile(parse(`let f = fn(x) { x * 2 }; f("a")`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, comp.Bytecode()); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	good := buf.Bytes()
+
+	newer := append([]byte{}, good...)
+	newer[len(Magic)+1]++
+
+	// no instructions, no positions and one constant with a made up tag
+	badTag := append(append([]byte{}, good[:len(Magic)+2]...), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 'x')
+
+	// reads fine, but the one instruction is an opcode there isn't
+	badOpcode := append(append([]byte{}, good[:len(Magic)+2]...), 0, 0, 0, 1, 200, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{"empty", nil, "not a monkey bytecode file"},
+		{"source", []byte("let x = 1;"), "not a monkey bytecode file"},
+		{"version", newer, "bytecode version 3 isn't supported (want 2)"},
+		{"truncated", good[:len(good)-3], "corrupt bytecode: unexpected EOF"},
+		{"header only", good[:len(Magic)+2], "corrupt bytecode: unexpected EOF"},
+		{"unknown tag", badTag, "corrupt bytecode: unknown constant tag 'x'"},
+		{"unknown opcode", badOpcode, "corrupt bytecode: main program: 0000: unknown opcode 200"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.input))
+		if err == nil {
+			t.Errorf("%s: expected an error, got none", tt.name)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+
+	if _, err := Decode(bytes.NewReader(nil)); !errors.Is(err, ErrNotBytecode) {
+		t.Errorf("expected ErrNotBytecode, got=%v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package compiler
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+/*
+optimize takes the finished instructions of a function (or of the main
+program) and gives back shorter ones that do the same thing:
+
+  - a condition that's a literal decides which branch runs while
+    compiling: `if (true)` loses its OpJumpNotTruthy altogether and
+    `if (false)` becomes a plain jump to the alternative
+  - a jump to another jump goes straight to where that one goes, and a
+    jump to the very next instruction is left out
+  - code nothing can get to is removed, like what comes after a return or
+    the branch a constant condition never takes
+
+the passes make work for each other - folding a condition leaves a branch
+that can't be reached, and removing that leaves a jump to the next
+instruction - so they run until none of them changes anything
+
+everything happens on the decoded instructions, with jump operands being
+indexes into that list instead of offsets, so removing an instruction
+doesn't mean patching every jump by hand. the offsets (of the jumps and
+the position table) are only worked out again at the very end
+*/
+func optimize(ins code.Instructions, positions code.PositionTable, constants []object.Object) (code.Instructions, code.PositionTable) {
+	list := decodeInstructions(ins, positions)
+
+	for changed := true; changed; {
+		changed = false
+		for _, pass := range []func([]instruction, []object.Object) bool{
+			foldConstantConditions,
+			threadJumps,
+			removeUnreachable,
+		} {
+			if pass(list, constants) {
+				list = compact(list)
+				changed = true
+			}
+		}
+	}
+
+	return encodeInstructions(list)
+}
+
+type instruction struct {
+	op       code.Opcode
+	operands []int
+
+	// only the instructions that can fail have a position
+	position *code.Position
+
+	deleted bool
+}
+
+func isJump(op code.Opcode) bool {
+	return op == code.OpJump || op == code.OpJumpNotTruthy
+}
+
+func decodeInstructions(ins code.Instructions, positions code.PositionTable) []instruction {
+	list := []instruction{}
+	indexes := map[int]int{} // offset -> index in list
+
+	for offset := 0; offset < len(ins); {
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			// can't happen with what the compiler emits
+			panic(err)
+		}
+
+		operands, read := code.ReadOperands(def, ins[offset+1:])
+		indexes[offset] = len(list)
+		list = append(list, instruction{op: code.Opcode(ins[offset]), operands: operands})
+
+		offset += 1 + read
+	}
+	// a jump can go to right after the last instruction
+	indexes[len(ins)] = len(list)
+
+	for i := range list {
+		if isJump(list[i].op) {
+			list[i].operands[0] = indexes[list[i].operands[0]]
+		}
+	}
+
+	for _, p := range positions {
+		if i, ok := indexes[p.Offset]; ok && i < len(list) {
+			p := p
+			list[i].position = &p
+		}
+	}
+
+	return list
+}
+
+func encodeInstructions(list []instruction) (code.Instructions, code.PositionTable) {
+	offsets := make([]int, len(list)+1)
+	for i, in := range list {
+		offsets[i+1] = offsets[i] + len(code.Make(in.op, in.operands...))
+	}
+
+	ins := code.Instructions{}
+	positions := code.PositionTable{}
+	for i, in := range list {
+		operands := in.operands
+		if isJump(in.op) {
+			operands = []int{offsets[operands[0]]}
+		}
+
+		if in.position != nil {
+			positions = append(positions, code.Position{
+				Offset: offsets[i],
+				Line:   in.position.Line,
+				Column: in.position.Column,
+			})
+		}
+		ins = append(ins, code.Make(in.op, operands...)...)
+	}
+
+	return ins, positions
+}
+
+// compact drops the deleted instructions. a jump to one of them goes to
+// the next instruction that's left instead, which is where the program
+// would have ended up anyway
+func compact(list []instruction) []instruction {
+	newIndexes := make([]int, len(list)+1)
+	kept := []instruction{}
+	for i, in := range list {
+		newIndexes[i] = len(kept)
+		if !in.deleted {
+			kept = append(kept, in)
+		}
+	}
+	newIndexes[len(list)] = len(kept)
+
+	for i := range kept {
+		if isJump(kept[i].op) {
+			kept[i].operands = []int{newIndexes[kept[i].operands[0]]}
+		}
+	}
+
+	return kept
+}
+
+func jumpTargets(list []instruction) map[int]bool {
+	targets := map[int]bool{}
+	for _, in := range list {
+		if isJump(in.op) {
+			targets[in.operands[0]] = true
+		}
+	}
+	return targets
+}
+
+/*
+a literal pushed right before an OpJumpNotTruthy is a condition whose
+outcome is already known. that doesn't hold when something jumps to the
+OpJumpNotTruthy itself - the value on the stack might come from somewhere
+else then, like the branches of an if used as the condition of another -
+so those are left alone
+*/
+func foldConstantConditions(list []instruction, constants []object.Object) bool {
+	targets := jumpTargets(list)
+	changed := false
+
+	for i := 1; i < len(list); i++ {
+		if list[i].op != code.OpJumpNotTruthy || targets[i] {
+			continue
+		}
+
+		truthy, ok := constantTruthiness(list[i-1], constants)
+		if !ok {
+			continue
+		}
+
+		list[i-1].deleted = true
+		if truthy {
+			list[i].deleted = true
+		} else {
+			list[i].op = code.OpJump
+		}
+		changed = true
+	}
+
+	return changed
+}
+
+// the same rules as the vm's isTruthy
+func constantTruthiness(in instruction, constants []object.Object) (truthy bool, ok bool) {
+	switch in.op {
+	case code.OpTrue:
+		return true, true
+	case code.OpFalse, code.OpNull:
+		return false, true
+	case code.OpConstant:
+		switch constants[in.operands[0]].(type) {
+		case *object.Integer, *object.String:
+			return true, true
+		}
+	}
+	return false, false
+}
+
+func threadJumps(list []instruction, constants []object.Object) bool {
+	changed := false
+
+	for i := range list {
+		if !isJump(list[i].op) {
+			continue
+		}
+
+		// seen stops a loop of jumps (which nothing compiles to, but still)
+		// from going around forever
+		target := list[i].operands[0]
+		seen := map[int]bool{i: true}
+		for target < len(list) && list[target].op == code.OpJump && !seen[target] {
+			seen[target] = true
+			target = list[target].operands[0]
+		}
+		if target != list[i].operands[0] {
+			list[i].operands[0] = target
+			changed = true
+		}
+
+		if list[i].op == code.OpJump && target == i+1 {
+			list[i].deleted = true
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// anything that can't be reached from the first instruction, by falling
+// through or following a jump, is dead
+func removeUnreachable(list []instruction, constants []object.Object) bool {
+	reachable := make([]bool, len(list))
+
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		if i >= len(list) || reachable[i] {
+			continue
+		}
+		reachable[i] = true
+
+		switch list[i].op {
+		case code.OpJump:
+			work = append(work, list[i].operands[0])
+		case code.OpJumpNotTruthy:
+			work = append(work, list[i].operands[0], i+1)
+		case code.OpReturnValue, code.OpReturn:
+		default:
+			work = append(work, i+1)
+		}
+	}
+
+	changed := false
+	for i := range list {
+		if !reachable[i] {
+			list[i].deleted = true
+			changed = true
+		}
+	}
+	return changed
+}
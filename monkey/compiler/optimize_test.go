@@ -0,0 +1,187 @@
+package compiler
+
+import (
+	"monkey/code"
+	"testing"
+)
+
+func TestOptimizations(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// a condition that's always true doesn't need a jump at
+			// all, and the alternative can never run
+			input:             "if (true) { 10 } else { 20 }; 3333;",
+			expectedConstants: []interface{}{10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `if ("yes") { 10 } else { 20 }`,
+			expectedConstants: []interface{}{"yes", 10, 20},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the missing else is a null
+			input:             "if (false) { 10 }",
+			expectedConstants: []interface{}{10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "return 1; 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input: "fn() { return 1; 2 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// both branches return, so neither gets to the nulls they push
+			// for the if's value or to the 3 after it
+			input: "fn() { if (1 < 2) { return 1; } else { return 2; } 3 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				3,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpConstant, 0),
+					// 0003
+					code.Make(code.OpConstant, 1),
+					// 0006
+					code.Make(code.OpLessThan),
+					// 0007
+					code.Make(code.OpJumpNotTruthy, 14),
+					// 0010
+					code.Make(code.OpConstant, 0),
+					// 0013
+					code.Make(code.OpReturnValue),
+					// 0014
+					code.Make(code.OpConstant, 1),
+					// 0017
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the inner if's jump lands on the outer if's jump, so it
+			// goes straight to the outer if's end instead
+			input:             "if (1 < 2) { if (2 < 1) { 10 } else { 20 } } else { 30 }; 40",
+			expectedConstants: []interface{}{1, 2, 10, 20, 30, 40},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpConstant, 1),
+				// 0006
+				code.Make(code.OpLessThan),
+				// 0007
+				code.Make(code.OpJumpNotTruthy, 32),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpConstant, 0),
+				// 0016
+				code.Make(code.OpLessThan),
+				// 0017
+				code.Make(code.OpJumpNotTruthy, 26),
+				// 0020
+				code.Make(code.OpConstant, 2),
+				// 0023
+				code.Make(code.OpJump, 35),
+				// 0026
+				code.Make(code.OpConstant, 3),
+				// 0029
+				code.Make(code.OpJump, 35),
+				// 0032
+				code.Make(code.OpConstant, 4),
+				// 0035
+				code.Make(code.OpPop),
+				// 0036
+				code.Make(code.OpConstant, 5),
+				// 0039
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the first if is the condition of the second, so the false
+			// in front of the second one's OpJumpNotTruthy isn't the only
+			// way to get there and nothing can be folded
+			input:             "if (if (1 < 2) { true } else { false }) { 10 }",
+			expectedConstants: []interface{}{1, 2, 10},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpConstant, 1),
+				// 0006
+				code.Make(code.OpLessThan),
+				// 0007
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0010
+				code.Make(code.OpTrue),
+				// 0011
+				code.Make(code.OpJump, 15),
+				// 0014
+				code.Make(code.OpFalse),
+				// 0015
+				code.Make(code.OpJumpNotTruthy, 24),
+				// 0018
+				code.Make(code.OpConstant, 2),
+				// 0021
+				code.Make(code.OpJump, 25),
+				// 0024
+				code.Make(code.OpNull),
+				// 0025
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestOptimizedPositions(t *testing.T) {
+	program := parse("if (true) { 1 } else { 2 }; 1 + true")
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	// OpConstant 0, OpPop, OpConstant 0, OpTrue, then the OpAdd
+	expected := code.PositionTable{{Offset: 8, Line: 1, Column: 31}}
+	if len(bytecode.Positions) != len(expected) || bytecode.Positions[0] != expected[0] {
+		t.Errorf("wrong positions. want=%+v, got=%+v", expected, bytecode.Positions)
+	}
+}
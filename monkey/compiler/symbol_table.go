@@ -0,0 +1,142 @@
+package compiler
+
+/*
+the symbol table is the compiler's version of object.Environment: instead
+of values it keeps track of *where* each name lives, so the vm can find
+values by index instead of looking names up while running
+
+  - globals are defined at the top level and live in the vm's globals store
+  - locals are parameters and lets inside a function body, kept on the stack
+    right above the function's frame
+  - builtins are defined up front and are looked up in object.Builtins
+  - free variables are locals of an enclosing function that a function
+    uses; they get copied into its closure when the closure is made
+  - a function's own name (when it's bound with let) resolves to the
+    closure that's running, which is how a local function calls itself
+
+every function body gets its own table, enclosed by the one it was
+compiled in
+*/
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// the original symbols (in the enclosing scope) of the free variables,
+	// in the order of their FreeScope indexes
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{store: s, FreeSymbols: free}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Copy gives a table with the same symbols that can be defined into
+// without touching s, so whatever a compile that failed halfway through
+// defined can be thrown away again
+func (s *SymbolTable) Copy() *SymbolTable {
+	c := &SymbolTable{
+		Outer:          s.Outer,
+		store:          make(map[string]Symbol, len(s.store)),
+		numDefinitions: s.numDefinitions,
+		FreeSymbols:    append([]Symbol{}, s.FreeSymbols...),
+	}
+	for name, symbol := range s.store {
+		c.store[name] = symbol
+	}
+	return c
+}
+
+// NumDefinitions is how many names were defined in this table, so the
+// globals (or locals) use indexes below it
+func (s *SymbolTable) NumDefinitions() int { return s.numDefinitions }
+
+// Define gives name the next free index in the table's scope. defining a
+// name that's already there (even a builtin) shadows the old symbol
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// builtins don't take up a global or local slot, their index is the one
+// they have in object.Builtins
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// the index is 0 since there's only ever one current closure
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+/*
+Resolve looks name up in this table and then the enclosing ones. globals
+and builtins can be used from anywhere as they are, but a local (or free
+variable) of an enclosing function becomes a free variable here - and on
+the way back in, in every table in between, so the value gets passed
+along from closure to closure
+*/
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+	return obj, ok
+}
@@ -0,0 +1,265 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+)
+
+/*
+verify checks bytecode that didn't just come out of the compiler - a .mkyc
+file, which can be truncated, edited by hand or not bytecode at all past
+the header - before the vm gets to run it. the vm trusts its code: it reads
+operands without checking they're there and indexes the constants, the
+stack and the closure's free variables with them, so anything the compiler
+would never have written is a panic waiting to happen
+
+for the main program and every function in the constants, verify makes
+sure that:
+  - every opcode is one the vm knows, and its operands are all there
+  - constants, builtins, locals and free variables are in range, and an
+    OpClosure's constant is a function
+  - jumps land on the start of an instruction
+  - the stack never goes below where the function started it, and it's the
+    same height however an instruction is reached
+  - a function doesn't run off its end without returning
+
+what it doesn't check is that a local is set before it's read - the
+compiler's own code does that whenever a let sits in a branch that didn't
+run, and the vm starts every local out as Null for it
+*/
+func verify(b *Bytecode) error {
+	v := &verifier{constants: b.Constants, needsFree: map[int]int{}}
+
+	if err := v.function(-1, b.Instructions, 0); err != nil {
+		return err
+	}
+	for i, c := range b.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		if fn.NumLocals > 1<<8 || fn.NumParameters > fn.NumLocals || fn.NumParameters >= 1<<8 {
+			return fmt.Errorf("%s: %d parameters and %d locals", unitName(i), fn.NumParameters, fn.NumLocals)
+		}
+		if err := v.function(i, fn.Instructions, fn.NumLocals); err != nil {
+			return err
+		}
+	}
+
+	// only now is it known how many free variables every function uses
+	for _, c := range v.closures {
+		if c.numFree < v.needsFree[c.constant] {
+			return fmt.Errorf("%s: %04d: constant %d uses %d free variables, the closure only has %d",
+				unitName(c.in), c.offset, c.constant, v.needsFree[c.constant], c.numFree)
+		}
+	}
+
+	return nil
+}
+
+type verifier struct {
+	constants []object.Object
+
+	// the closures made so far, and how many free variables each function
+	// needs, by constant index
+	closures  []closureSite
+	needsFree map[int]int
+}
+
+type closureSite struct {
+	in       int // the constant index of the function it's in, -1 for main
+	offset   int
+	constant int
+	numFree  int
+}
+
+// unitName is how errors refer to the constant index of a function, or
+// the main program for -1
+func unitName(index int) string {
+	if index < 0 {
+		return "main program"
+	}
+	return fmt.Sprintf("constant %d", index)
+}
+
+func (v *verifier) function(index int, ins code.Instructions, numLocals int) error {
+	what := unitName(index)
+
+	operands := make(map[int][]int)
+	starts := make([]bool, len(ins)+1)
+	starts[len(ins)] = true
+
+	for offset := 0; offset < len(ins); {
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			return fmt.Errorf("%s: %04d: unknown opcode %d", what, offset, ins[offset])
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if offset+1+width > len(ins) {
+			return fmt.Errorf("%s: %04d: %s is missing its operands", what, offset, def.Name)
+		}
+
+		read, _ := code.ReadOperands(def, ins[offset+1:])
+		if err := v.operands(index, code.Opcode(ins[offset]), read, len(ins), numLocals); err != nil {
+			return fmt.Errorf("%s: %04d: %s", what, offset, err)
+		}
+		if code.Opcode(ins[offset]) == code.OpClosure {
+			v.closures = append(v.closures, closureSite{index, offset, read[0], read[1]})
+		}
+
+		starts[offset] = true
+		operands[offset] = read
+		offset += 1 + width
+	}
+
+	for offset, read := range operands {
+		op := code.Opcode(ins[offset])
+		if (op == code.OpJump || op == code.OpJumpNotTruthy) && !starts[read[0]] {
+			return fmt.Errorf("%s: %04d: jump into the middle of an instruction", what, offset)
+		}
+	}
+
+	return stackHeights(what, ins, operands, index < 0)
+}
+
+// everything about an operand that can be checked on its own
+func (v *verifier) operands(index int, op code.Opcode, operands []int, length, numLocals int) error {
+	switch op {
+	case code.OpConstant:
+		if operands[0] >= len(v.constants) {
+			return fmt.Errorf("no constant %d", operands[0])
+		}
+	case code.OpJump, code.OpJumpNotTruthy:
+		if operands[0] > length {
+			return fmt.Errorf("jump past the end")
+		}
+	case code.OpGetLocal, code.OpSetLocal:
+		if operands[0] >= numLocals {
+			return fmt.Errorf("no local %d", operands[0])
+		}
+	case code.OpGetBuiltin:
+		if operands[0] >= len(object.Builtins) {
+			return fmt.Errorf("no builtin %d", operands[0])
+		}
+	case code.OpGetFree:
+		// the main program isn't a closure anything made
+		if index < 0 {
+			return fmt.Errorf("no free variables in the main program")
+		}
+		v.needsFree[index] = max(v.needsFree[index], operands[0]+1)
+	case code.OpHash:
+		if operands[0]%2 != 0 {
+			return fmt.Errorf("a hash of %d keys and values", operands[0])
+		}
+	case code.OpClosure:
+		if operands[0] >= len(v.constants) {
+			return fmt.Errorf("no constant %d", operands[0])
+		}
+		if _, ok := v.constants[operands[0]].(*object.CompiledFunction); !ok {
+			return fmt.Errorf("constant %d isn't a function", operands[0])
+		}
+	}
+	return nil
+}
+
+/*
+stackHeights follows every path through ins, keeping track of how many
+values each instruction leaves on the stack. the compiler's code only ever
+takes off what it put on, and both branches of an if leave the same, so
+anything else would have the vm reading below the function's part of the
+stack - into the caller's or off the bottom of it
+*/
+func stackHeights(what string, ins code.Instructions, operands map[int][]int, main bool) error {
+	heights := map[int]int{0: 0}
+	todo := []int{0}
+
+	reach := func(offset, height int) error {
+		if offset == len(ins) {
+			if !main {
+				return fmt.Errorf("%s: runs off its end without returning", what)
+			}
+			return nil
+		}
+		if h, ok := heights[offset]; ok {
+			if h != height {
+				return fmt.Errorf("%s: %04d: reached with %d values on the stack and with %d", what, offset, h, height)
+			}
+			return nil
+		}
+		heights[offset] = height
+		todo = append(todo, offset)
+		return nil
+	}
+
+	if len(ins) == 0 {
+		return reach(0, 0)
+	}
+
+	for len(todo) > 0 {
+		offset := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+
+		op := code.Opcode(ins[offset])
+		read := operands[offset]
+		pops, pushes := stackEffect(op, read)
+
+		height := heights[offset]
+		if height < pops {
+			return fmt.Errorf("%s: %04d: takes %d values off a stack of %d", what, offset, pops, height)
+		}
+		height = height - pops + pushes
+
+		def, _ := code.Lookup(byte(op))
+		next := offset + 1
+		for _, w := range def.OperandWidths {
+			next += w
+		}
+
+		var err error
+		switch op {
+		case code.OpReturnValue, code.OpReturn:
+		case code.OpJump:
+			err = reach(read[0], height)
+		case code.OpJumpNotTruthy:
+			if err = reach(read[0], height); err == nil {
+				err = reach(next, height)
+			}
+		default:
+			err = reach(next, height)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// how many values op takes off the stack and puts back on
+func stackEffect(op code.Opcode, operands []int) (int, int) {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetBuiltin, code.OpGetFree, code.OpCurrentClosure:
+		return 0, 1
+	case code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal, code.OpReturnValue:
+		return 1, 0
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan, code.OpIndex:
+		return 2, 1
+	case code.OpMinus, code.OpBang:
+		return 1, 1
+	case code.OpArray, code.OpHash, code.OpClosure:
+		return operands[len(operands)-1], 1
+	case code.OpCall:
+		// the function and its arguments, for what it returns
+		return operands[0] + 1, 1
+	default:
+		return 0, 0
+	}
+}
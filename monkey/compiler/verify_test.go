@@ -0,0 +1,88 @@
+package compiler
+
+import (
+	"monkey/code"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	ins := func(instructions ...[]byte) code.Instructions {
+		var out code.Instructions
+		for _, i := range instructions {
+			out = append(out, i...)
+		}
+		return out
+	}
+	fn := func(numLocals, numParameters int, instructions ...[]byte) *object.CompiledFunction {
+		return &object.CompiledFunction{Instructions: ins(instructions...), NumLocals: numLocals, NumParameters: numParameters}
+	}
+	one := &object.Integer{Value: 1}
+
+	tests := []struct {
+		name      string
+		main      code.Instructions
+		constants []object.Object
+		expected  string // "" when it's fine
+	}{
+		{"empty", nil, nil, ""},
+		{
+			"if/else",
+			ins(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 10), code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11), code.Make(code.OpNull), code.Make(code.OpPop)),
+			[]object.Object{one},
+			"",
+		},
+		{
+			"closure",
+			ins(code.Make(code.OpConstant, 0), code.Make(code.OpClosure, 1, 1), code.Make(code.OpPop)),
+			[]object.Object{one, fn(1, 1, code.Make(code.OpGetFree, 0), code.Make(code.OpGetLocal, 0), code.Make(code.OpAdd), code.Make(code.OpReturnValue))},
+			"",
+		},
+		{"unknown opcode", code.Instructions{200}, nil, "main program: 0000: unknown opcode 200"},
+		{"missing operands", code.Make(code.OpConstant, 0)[:2], []object.Object{one}, "main program: 0000: OpConstant is missing its operands"},
+		{"no constant", ins(code.Make(code.OpConstant, 1), code.Make(code.OpPop)), []object.Object{one}, "main program: 0000: no constant 1"},
+		{"no builtin", ins(code.Make(code.OpGetBuiltin, 200), code.Make(code.OpPop)), nil, "main program: 0000: no builtin 200"},
+		{"local in main", ins(code.Make(code.OpGetLocal, 0), code.Make(code.OpPop)), nil, "main program: 0000: no local 0"},
+		{"free in main", ins(code.Make(code.OpGetFree, 0), code.Make(code.OpPop)), nil, "main program: 0000: no free variables in the main program"},
+		{"jump past the end", code.Make(code.OpJump, 4), nil, "main program: 0000: jump past the end"},
+		{
+			"jump into an instruction",
+			ins(code.Make(code.OpJump, 4), code.Make(code.OpConstant, 0), code.Make(code.OpPop)),
+			[]object.Object{one},
+			"main program: 0000: jump into the middle of an instruction",
+		},
+		{"odd hash", ins(code.Make(code.OpTrue), code.Make(code.OpHash, 1), code.Make(code.OpPop)), nil, "main program: 0001: a hash of 1 keys and values"},
+		{"underflow", code.Make(code.OpPop), nil, "main program: 0000: takes 1 values off a stack of 0"},
+		{
+			"branches differ",
+			ins(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 5), code.Make(code.OpTrue), code.Make(code.OpNull)),
+			nil,
+			"main program: 0005: reached with 0 values on the stack and with 1",
+		},
+		{"closure of an integer", ins(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)), []object.Object{one}, "main program: 0000: constant 0 isn't a function"},
+		{
+			"not enough free variables",
+			ins(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)),
+			[]object.Object{fn(0, 0, code.Make(code.OpGetFree, 1), code.Make(code.OpReturnValue))},
+			"main program: 0000: constant 0 uses 2 free variables, the closure only has 0",
+		},
+		{"no return", nil, []object.Object{fn(0, 0, code.Make(code.OpTrue), code.Make(code.OpPop))}, "constant 0: runs off its end without returning"},
+		{"local out of range", nil, []object.Object{fn(1, 0, code.Make(code.OpGetLocal, 1), code.Make(code.OpReturnValue))}, "constant 0: 0000: no local 1"},
+		{"more parameters than locals", nil, []object.Object{fn(1, 2, code.Make(code.OpReturn))}, "constant 0: 2 parameters and 1 locals"},
+	}
+
+	for _, tt := range tests {
+		err := verify(&Bytecode{Instructions: tt.main, Constants: tt.constants})
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
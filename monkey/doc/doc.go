@@ -0,0 +1,242 @@
+/*
+Package doc turns the /// comments in a monkey program into documentation,
+the way go doc does for go. a doc comment is a run of /// lines right above
+a top-level let, with nothing in between:
+
+	/// add returns the sum of a and b.
+	///
+	/// it works on strings too.
+	let add = fn(a, b) { a + b };
+
+the let gets an Entry with the comment's text (the /// and one space after
+it taken off every line) and a signature worked out from the tree - fn
+add(a, b) here. a let of a hash is a module, and its functions get
+entries of their own, documented by /// lines above their keys:
+
+	let math = {
+		/// max returns the bigger of a and b.
+		"max": fn(a, b) { if (a > b) { a } else { b } },
+	};
+
+every top-level let is listed, documented or not, except the ones whose
+names start with _. a /// comment at the top of the file that isn't right
+above a let (a blank line sets it apart) is about the whole file.
+
+Markdown and HTML print what Source found
+*/
+package doc
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+)
+
+type File struct {
+	Name    string // the heading it gets, usually the path; up to the caller
+	Doc     string // the comment at the top, "" if there isn't one
+	Entries []*Entry
+}
+
+type Entry struct {
+	Name      string // add, or math.max for a function in a module
+	Module    string // math for math.max, "" for a top-level let
+	Signature string // fn add(a, b), let pi = 314
+	Doc       string // "" when there's no comment
+	Line      int
+}
+
+/*
+Source parses src and collects its documentation. a program that doesn't
+parse has no tree to take signatures from, so all that comes back then
+are the parser's errors
+*/
+func Source(src string) (*File, []parser.ParseError) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) > 0 {
+		return nil, p.ParseErrors()
+	}
+
+	comments := docLines(src, program)
+	f := &File{}
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || strings.HasPrefix(let.Name.Value, "_") {
+			continue
+		}
+
+		f.Entries = append(f.Entries, &Entry{
+			Name:      let.Name.Value,
+			Signature: signature(let.Name.Value, let.Value),
+			Doc:       comments.above(let.Token.Line),
+			Line:      let.Token.Line,
+		})
+
+		if hash, ok := let.Value.(*ast.HashLiteral); ok {
+			f.Entries = append(f.Entries, members(let.Name.Value, hash, comments)...)
+		}
+	}
+
+	// the comment at the top is the file's if no let took it
+	line := comments.first()
+	if line > 0 && comments.unused(line) && (len(program.Statements) == 0 || line < statementLine(program.Statements[0])) {
+		f.Doc = comments.below(line)
+	}
+
+	return f, nil
+}
+
+func statementLine(stmt ast.Statement) int {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token.Line
+	case *ast.ReturnStatement:
+		return stmt.Token.Line
+	case *ast.ExpressionStatement:
+		return stmt.Token.Line
+	}
+	return 0
+}
+
+// the functions in a module, under string keys
+func members(module string, hash *ast.HashLiteral, comments docComments) []*Entry {
+	var entries []*Entry
+
+	for _, key := range hash.Keys {
+		name, ok := key.(*ast.StringLiteral)
+		if !ok || strings.HasPrefix(name.Value, "_") {
+			continue
+		}
+		fn, ok := hash.Pairs[key].(*ast.FunctionLiteral)
+		if !ok {
+			continue
+		}
+
+		entries = append(entries, &Entry{
+			Name:      module + "." + name.Value,
+			Module:    module,
+			Signature: module + `["` + name.Value + `"] = ` + parameters("fn", fn),
+			Doc:       comments.above(name.Token.Line),
+			Line:      name.Token.Line,
+		})
+	}
+
+	return entries
+}
+
+/*
+signature is what the entry is, as close to the source as it's useful:
+the parameters of a function, the value of a let of an integer, string or
+boolean, and just the name of anything else - an expression or a whole
+hash of them says more in the source than it would here
+*/
+func signature(name string, value ast.Expression) string {
+	switch value := value.(type) {
+	case *ast.FunctionLiteral:
+		return parameters("fn "+name, value)
+	case *ast.StringLiteral:
+		return "let " + name + ` = "` + value.Value + `"`
+	case *ast.IntegerLiteral, *ast.Boolean:
+		return "let " + name + " = " + value.String()
+	case *ast.PrefixExpression:
+		// negative numbers
+		if _, ok := value.Right.(*ast.IntegerLiteral); ok && value.Operator == "-" {
+			return "let " + name + " = " + value.Operator + value.Right.String()
+		}
+	}
+	return "let " + name
+}
+
+func parameters(prefix string, fn *ast.FunctionLiteral) string {
+	names := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		names[i] = p.Value
+	}
+	return prefix + "(" + strings.Join(names, ", ") + ")"
+}
+
+/*
+docComments are the /// lines of a program by line number, with what's
+left of them once the /// is gone. only comments on a line of their own
+count - one at the end of a line of code is about that line, not the one
+below it
+*/
+type docComments struct {
+	lines map[int]string
+	used  map[int]bool // the lines that went into an entry's doc
+}
+
+func docLines(src string, program *ast.Program) docComments {
+	c := docComments{lines: map[int]string{}, used: map[int]bool{}}
+	srcLines := strings.Split(src, "\n")
+
+	for _, tok := range program.Comments {
+		text, ok := strings.CutPrefix(tok.Literal, "///")
+		if !ok || strings.HasPrefix(text, "/") {
+			continue
+		}
+		if tok.Line > len(srcLines) || tok.Column-1 > len(srcLines[tok.Line-1]) ||
+			strings.TrimLeft(srcLines[tok.Line-1][:tok.Column-1], " \t") != "" {
+			continue
+		}
+		c.lines[tok.Line] = strings.TrimPrefix(text, " ")
+	}
+
+	return c
+}
+
+// above takes the run of doc lines that ends on the line before line
+func (c docComments) above(line int) string {
+	start := line
+	for {
+		if _, ok := c.lines[start-1]; !ok {
+			break
+		}
+		start--
+	}
+	if start == line {
+		return ""
+	}
+
+	for l := start; l < line; l++ {
+		c.used[l] = true
+	}
+	return c.join(start, line)
+}
+
+// below takes the run of doc lines that starts on line
+func (c docComments) below(line int) string {
+	end := line
+	for {
+		if _, ok := c.lines[end]; !ok {
+			break
+		}
+		end++
+	}
+	return c.join(line, end)
+}
+
+func (c docComments) join(start, end int) string {
+	lines := make([]string, 0, end-start)
+	for l := start; l < end; l++ {
+		lines = append(lines, c.lines[l])
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+func (c docComments) first() int {
+	first := 0
+	for line := range c.lines {
+		if first == 0 || line < first {
+			first = line
+		}
+	}
+	return first
+}
+
+func (c docComments) unused(line int) bool {
+	return !c.used[line]
+}
@@ -0,0 +1,132 @@
+package doc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const lib = `/// Helpers for numbers.
+
+/// add returns the sum of ` + "`a` and `b`" + `.
+///
+/// 	add(1, 2) // 3
+let add = fn(a, b) { a + b };
+
+let pi = 314; /// about the line it's on, not the next
+//// four slashes aren't a doc comment
+let neg = -1;
+let _hidden = 1;
+
+/// math is a module.
+let math = {
+	/// max returns the bigger of a and b.
+	"max": fn(a, b) { if (a > b) { a } else { b } },
+	"zero": 0,
+};
+add(pi, neg)
+`
+
+func TestSource(t *testing.T) {
+	f, errors := Source(lib)
+	if errors != nil {
+		t.Fatalf("unexpected parse errors: %v", errors)
+	}
+
+	if f.Doc != "Helpers for numbers." {
+		t.Errorf("wrong file doc. got=%q", f.Doc)
+	}
+
+	expected := []Entry{
+		{Name: "add", Signature: "fn add(a, b)", Doc: "add returns the sum of `a` and `b`.\n\n\tadd(1, 2) // 3", Line: 6},
+		{Name: "pi", Signature: "let pi = 314", Line: 8},
+		{Name: "neg", Signature: "let neg = -1", Line: 10},
+		{Name: "math", Signature: "let math", Doc: "math is a module.", Line: 14},
+		{Name: "math.max", Module: "math", Signature: `math["max"] = fn(a, b)`, Doc: "max returns the bigger of a and b.", Line: 16},
+	}
+	if len(f.Entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(f.Entries))
+	}
+	for i, e := range f.Entries {
+		if *e != expected[i] {
+			t.Errorf("entries[%d] - expected %+v, got %+v", i, expected[i], *e)
+		}
+	}
+}
+
+// a comment at the top belongs to the file only if it isn't right above
+// the first let
+func TestSourceFileDoc(t *testing.T) {
+	tests := []struct {
+		input    string
+		file     string
+		firstLet string
+	}{
+		{"/// the file\n\nlet x = 1;", "the file", ""},
+		{"/// x\nlet x = 1;", "", "x"},
+		{"/// the file\n\n/// x\nlet x = 1;", "the file", "x"},
+		{"let x = 1;\n/// floating\n\nlet y = 2;", "", ""},
+		{"/// only a comment", "only a comment", ""},
+	}
+
+	for _, tt := range tests {
+		f, errors := Source(tt.input)
+		if errors != nil {
+			t.Fatalf("%q: unexpected parse errors: %v", tt.input, errors)
+		}
+		if f.Doc != tt.file {
+			t.Errorf("%q: wrong file doc. expected=%q, got=%q", tt.input, tt.file, f.Doc)
+		}
+		if len(f.Entries) > 0 && f.Entries[0].Doc != tt.firstLet {
+			t.Errorf("%q: wrong doc for the first let. expected=%q, got=%q", tt.input, tt.firstLet, f.Entries[0].Doc)
+		}
+	}
+}
+
+func TestSourceParseErrors(t *testing.T) {
+	f, errors := Source("/// x\nlet x = ;")
+	if f != nil || len(errors) == 0 {
+		t.Errorf("expected only parse errors, got %+v, %v", f, errors)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	f, _ := Source(lib)
+	f.Name = "lib.mky"
+
+	var out bytes.Buffer
+	if err := Markdown(&out, f); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+
+	expected := "# lib.mky\n\nHelpers for numbers.\n\n" +
+		"## add\n\n```\nfn add(a, b)\n```\n\nadd returns the sum of `a` and `b`.\n\n\tadd(1, 2) // 3\n\n" +
+		"## pi\n\n```\nlet pi = 314\n```\n\n" +
+		"## neg\n\n```\nlet neg = -1\n```\n\n" +
+		"## math\n\n```\nlet math\n```\n\nmath is a module.\n\n" +
+		"### math.max\n\n```\nmath[\"max\"] = fn(a, b)\n```\n\nmax returns the bigger of a and b.\n"
+	if out.String() != expected {
+		t.Errorf("wrong markdown.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestHTML(t *testing.T) {
+	f, _ := Source(lib)
+	f.Name = "lib.mky"
+
+	var out bytes.Buffer
+	if err := HTML(&out, "lib <docs>", f); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+
+	for _, s := range []string{
+		"<title>lib &lt;docs&gt;</title>",
+		`<h1 id="lib.mky">lib.mky</h1>` + "\n<p>Helpers for numbers.</p>",
+		`<h2 id="add">add</h2>` + "\n<pre>fn add(a, b)</pre>\n<p>add returns the sum of <code>a</code> and <code>b</code>.</p>\n<pre>add(1, 2) // 3</pre>",
+		`<h3 id="math.max">math.max</h3>` + "\n<pre>math[&#34;max&#34;] = fn(a, b)</pre>",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("page is missing %q. got=%s", s, out.String())
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package doc
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"strings"
+)
+
+/*
+Markdown writes the files as markdown, a heading for each file and each
+entry (a smaller one for the functions of a module), the signature as a
+code block and the comment under it as is - doc comments are written in
+markdown, more or less, so they come out about right
+*/
+func Markdown(w io.Writer, files ...*File) error {
+	var b strings.Builder
+
+	for i, f := range files {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# %s\n", f.Name)
+		if f.Doc != "" {
+			fmt.Fprintf(&b, "\n%s\n", f.Doc)
+		}
+
+		for _, e := range f.Entries {
+			heading := "##"
+			if e.Module != "" {
+				heading = "###"
+			}
+			fmt.Fprintf(&b, "\n%s %s\n\n```\n%s\n```\n", heading, e.Name, e.Signature)
+			if e.Doc != "" {
+				fmt.Fprintf(&b, "\n%s\n", e.Doc)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// HTML writes the files as one page, laid out like Markdown does it. the
+// headings have the names as ids, so #add links to add
+func HTML(w io.Writer, title string, files ...*File) error {
+	return page.Execute(w, struct {
+		Title string
+		Files []*File
+	}{title, files})
+}
+
+var page = template.Must(template.New("doc").Funcs(template.FuncMap{"paragraphs": paragraphs}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; line-height: 1.4; }
+pre { background: #f4f4f4; padding: 0.5em 1em; overflow-x: auto; }
+</style>
+</head>
+<body>
+{{- range .Files}}
+<h1 id="{{.Name}}">{{.Name}}</h1>{{paragraphs .Doc}}
+{{- range .Entries}}
+{{if .Module}}<h3 id="{{.Name}}">{{.Name}}</h3>{{else}}<h2 id="{{.Name}}">{{.Name}}</h2>{{end}}
+<pre>{{.Signature}}</pre>{{paragraphs .Doc}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+/*
+paragraphs is the little bit of markdown HTML understands: a blank line
+starts a new paragraph, lines indented with a tab (or four spaces) are
+code, and so is anything between backquotes
+*/
+func paragraphs(text string) template.HTML {
+	var b strings.Builder
+
+	for _, block := range strings.Split(text, "\n\n") {
+		block = strings.Trim(block, "\n")
+		if block == "" {
+			continue
+		}
+
+		lines := strings.Split(block, "\n")
+		if indented(lines) {
+			for i, line := range lines {
+				lines[i] = html.EscapeString(strings.TrimPrefix(strings.TrimPrefix(line, "\t"), "    "))
+			}
+			fmt.Fprintf(&b, "\n<pre>%s</pre>", strings.Join(lines, "\n"))
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n<p>%s</p>", inlineCode(block))
+	}
+
+	return template.HTML(b.String())
+}
+
+func indented(lines []string) bool {
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, "    ") {
+			return false
+		}
+	}
+	return true
+}
+
+// the odd pieces between backquotes are code, the even ones text
+func inlineCode(text string) string {
+	pieces := strings.Split(text, "`")
+	if len(pieces)%2 == 0 {
+		// an unmatched backquote is just a backquote
+		return html.EscapeString(text)
+	}
+
+	for i, piece := range pieces {
+		pieces[i] = html.EscapeString(piece)
+		if i%2 == 1 {
+			pieces[i] = "<code>" + pieces[i] + "</code>"
+		}
+	}
+	return strings.Join(pieces, "")
+}
@@ -0,0 +1,27 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"sort"
+)
+
+// the builtins themselves are defined in the object package, since the vm
+// needs them too; evalIdentifier looks them up here when a name isn't
+// bound in the environment
+var builtins = map[string]*object.Builtin{}
+
+func init() {
+	for _, def := range object.Builtins {
+		builtins[def.Name] = def.Builtin
+	}
+}
+
+// BuiltinNames returns the names of all builtin functions, sorted
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,21 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"monkey/profile"
+)
+
+// enterProfile tells p about a call to fn, when the environment has a
+// profile (see object.Environment.SetProfile)
+func enterProfile(p *profile.Profile, fn object.Object) {
+	switch fn := fn.(type) {
+	case *object.Function:
+		p.Enter(fn.Name, fn.Body.Token.Line)
+	case *object.Builtin:
+		name := object.BuiltinName(fn)
+		if name == "" {
+			name = "builtin"
+		}
+		p.Enter(name, 0)
+	}
+}
@@ -0,0 +1,53 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"reflect"
+	"strings"
+)
+
+/*
+evalTraced is Eval with a trace, which is on when the environment has one
+(see object.Environment.SetTrace). it writes a line for every node it
+finishes evaluating, e.g. for 1 + 2 * 3:
+
+	  IntegerLiteral 1 => 1
+	    IntegerLiteral 2 => 2
+	    IntegerLiteral 3 => 3
+	  InfixExpression (2 * 3) => 6
+	InfixExpression (1 + (2 * 3)) => 7
+
+children are printed before their parent and indented one level deeper,
+so each line's value is built from the lines above it. nodes that only
+pass a value along (programs, blocks, expression statements) are left out
+to keep the noise down
+*/
+func evalTraced(node ast.Node, env *object.Environment, trace *object.Trace) object.Object {
+	switch node.(type) {
+	case *ast.Program, *ast.BlockStatement, *ast.ExpressionStatement:
+		return eval(node, env)
+	}
+
+	trace.Depth++
+	result := eval(node, env)
+	trace.Depth--
+
+	value := "<nil>"
+	if result != nil {
+		value = result.Inspect()
+	}
+
+	fmt.Fprintf(trace.Out, "%s%s %s => %s\n",
+		strings.Repeat("  ", trace.Depth),
+		reflect.TypeOf(node).Elem().Name(),
+		oneLine(node.String()),
+		oneLine(value))
+
+	return result
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,556 @@
+/*
+Package format prints monkey programs in one canonical style, the way
+gofmt does for go (and monkeyfmt is to this package what gofmt is to
+go/format):
+
+  - one statement per line, indented with tabs, and a ; after every
+    statement that isn't the value of its block. a statement that's an if
+    doesn't need one either, unless what comes next would carry on from it
+  - spaces around infix operators and after commas, but never inside
+    parentheses, and only the parentheses the precedence needs
+  - blocks, arrays and hashes stay on one line if they were written on
+    one line, otherwise they get a line per statement (or element)
+  - blank lines between statements are kept, as a single one
+
+comments are kept: on a line of their own they stay above what they were
+above, at the end of a line they stay at the end of it. the one place
+they move is out of the middle of an expression that gets printed on one
+line - down to the next line that has room for them
+*/
+package format
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+// Error is a source that doesn't parse, and so can't be formatted
+type Error struct {
+	Errors []parser.ParseError
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = fmt.Sprintf("%d:%d: %s", err.Line, err.Column, err.Message)
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Source formats a whole program. the result always ends in a newline
+// (unless there's nothing in it)
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		return nil, &Error{Errors: p.ParseErrors()}
+	}
+
+	pr := newPrinter(string(src), program.Comments)
+	pr.program(program)
+	return []byte(pr.out.String()), nil
+}
+
+/*
+the AST knows where every node starts but not where it ends, and that
+matters for the layout (was the block on one line?) and for the comments
+(is this one at the end of the statement's line?). so the printer has the
+tokens of the source next to the tree and finds the ends there: the token
+before where the next statement starts, or the bracket that closes the
+one a node starts with
+*/
+type printer struct {
+	out       strings.Builder
+	indent    int
+	lineStart bool // the indentation of the line is still to be written
+
+	tokens  []token.Token
+	indexes map[[2]int]int // line and column -> index in tokens
+
+	comments []token.Token
+	next     int // the first comment that hasn't been printed
+
+	lastLine int // the source line of what was printed last, for blank lines
+}
+
+func newPrinter(src string, comments []token.Token) *printer {
+	pr := &printer{
+		tokens:   lexer.Tokenize(src),
+		indexes:  map[[2]int]int{},
+		comments: comments,
+	}
+	for i, tok := range pr.tokens {
+		pr.indexes[[2]int{tok.Line, tok.Column}] = i
+	}
+	return pr
+}
+
+func (pr *printer) write(s string) {
+	if pr.lineStart {
+		pr.out.WriteString(strings.Repeat("\t", pr.indent))
+		pr.lineStart = false
+	}
+	pr.out.WriteString(s)
+}
+
+// newline ends the line. the next one gets indented once there's
+// something on it, so blank lines stay empty
+func (pr *printer) newline() {
+	pr.out.WriteString("\n")
+	pr.lineStart = true
+}
+
+func (pr *printer) indexOf(tok token.Token) int {
+	if i, ok := pr.indexes[[2]int{tok.Line, tok.Column}]; ok {
+		return i
+	}
+	return -1
+}
+
+// closing finds the bracket that closes the one at tokens[open]
+func (pr *printer) closing(open int) int {
+	depth := 0
+	for i := open; i < len(pr.tokens); i++ {
+		switch pr.tokens[i].Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(pr.tokens) - 1
+}
+
+func before(a, b token.Token) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// whether there are comments between two tokens
+func (pr *printer) commentsBetween(from, to token.Token) bool {
+	for _, c := range pr.comments[pr.next:] {
+		if before(from, c) && before(c, to) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+flush prints the comments that come before pos in the source, each on a
+line of its own. first says nothing has been printed on the current
+level yet (right after a {, say), which needs no newline first
+*/
+func (pr *printer) flush(pos token.Token, first bool) bool {
+	for pr.next < len(pr.comments) && before(pr.comments[pr.next], pos) {
+		c := pr.comments[pr.next]
+		if !first {
+			pr.newline()
+			if c.Line > pr.lastLine+1 && pr.lastLine > 0 {
+				pr.newline()
+			}
+		}
+		pr.write(strings.TrimRight(c.Literal, " \t"))
+		pr.lastLine = max(pr.lastLine, c.Line)
+		pr.next++
+		first = false
+	}
+	return first
+}
+
+// trailing puts a comment that's on line at the end of what was just
+// printed
+func (pr *printer) trailing(line int) {
+	if pr.next < len(pr.comments) && pr.comments[pr.next].Line == line {
+		pr.write(" " + strings.TrimRight(pr.comments[pr.next].Literal, " \t"))
+		pr.next++
+	}
+}
+
+func (pr *printer) program(program *ast.Program) {
+	end := len(pr.tokens) - 1 // the EOF
+	first := pr.statements(program.Statements, pr.tokens[end], false)
+
+	pr.flush(pr.tokens[end], first)
+	if pr.out.Len() > 0 {
+		pr.newline()
+	}
+}
+
+/*
+statements prints a list of statements, one per line, with the comments
+among them. end is where the list stops in the source (the } of a block,
+the EOF), and first says whether the list starts a new level
+*/
+func (pr *printer) statements(stmts []ast.Statement, end token.Token, block bool) bool {
+	first := true
+
+	for i, stmt := range stmts {
+		start := firstToken(stmt)
+		first = pr.flush(start, first)
+
+		if !first {
+			pr.newline()
+			if start.Line > pr.lastLine+1 && pr.lastLine > 0 {
+				pr.newline()
+			}
+		}
+		first = false
+
+		var next ast.Statement
+		last := pr.indexOf(end) - 1
+		if i+1 < len(stmts) {
+			next = stmts[i+1]
+			last = pr.after(next) - 1
+		}
+
+		pr.statement(stmt, next, block && next == nil)
+
+		if last >= 0 && last < len(pr.tokens) {
+			pr.lastLine = pr.tokens[last].Line
+			pr.trailing(pr.lastLine)
+		}
+	}
+
+	return first
+}
+
+// value says the statement is the last one of a block, whose value it is
+func (pr *printer) statement(stmt ast.Statement, next ast.Statement, value bool) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		pr.write("let " + stmt.Name.Value + " = ")
+		pr.expression(stmt.Value)
+		pr.write(";")
+
+	case *ast.ReturnStatement:
+		pr.write("return ")
+		pr.expression(stmt.ReturnValue)
+		pr.write(";")
+
+	case *ast.ExpressionStatement:
+		pr.expression(stmt.Expression)
+		if !value && needsSemicolon(stmt, next) {
+			pr.write(";")
+		}
+	}
+}
+
+// an if goes without a ; unless the next statement starts with something
+// that would make it an operand: if (a) { b } (c) calls the if's value
+func needsSemicolon(stmt *ast.ExpressionStatement, next ast.Statement) bool {
+	if _, ok := stmt.Expression.(*ast.IfExpression); !ok {
+		return true
+	}
+
+	es, ok := next.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	switch startsWith(es.Expression) {
+	case "(", "[", "-":
+		return true
+	}
+	return false
+}
+
+// what the printed e starts with, as far as needsSemicolon cares
+func startsWith(e ast.Expression) string {
+	var left ast.Expression
+	min := 0
+
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		left, min = e.Left, precedence(e)
+	case *ast.CallExpression:
+		left, min = e.Function, call
+	case *ast.IndexExpression:
+		left, min = e.Left, call
+	case *ast.PrefixExpression:
+		return e.Operator
+	case *ast.ArrayLiteral:
+		return "["
+	default:
+		return ""
+	}
+
+	if precedence(left) < min {
+		return "("
+	}
+	return startsWith(left)
+}
+
+// the parser's precedences, from loosest to tightest
+const (
+	_ int = iota
+	lowest
+	equals      // ==
+	lessGreater // > or <
+	sum         // +
+	product     // *
+	prefix      // -x or !x
+	call        // f(x) and a[i]
+	atom        // everything that can't be split up
+)
+
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		switch e.Operator {
+		case "==", "!=":
+			return equals
+		case "<", ">":
+			return lessGreater
+		case "+", "-":
+			return sum
+		case "*", "/":
+			return product
+		}
+		return lowest
+	case *ast.PrefixExpression:
+		return prefix
+	case *ast.CallExpression, *ast.IndexExpression:
+		return call
+	}
+	return atom
+}
+
+// operand prints e, in parentheses if it binds looser than min
+func (pr *printer) operand(e ast.Expression, min int) {
+	if precedence(e) < min {
+		pr.write("(")
+		pr.expression(e)
+		pr.write(")")
+		return
+	}
+	pr.expression(e)
+}
+
+func (pr *printer) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		pr.write(e.Value)
+	case *ast.IntegerLiteral:
+		pr.write(e.Token.Literal)
+	case *ast.StringLiteral:
+		pr.write(`"` + e.Value + `"`)
+	case *ast.Boolean:
+		pr.write(e.Token.Literal)
+
+	case *ast.PrefixExpression:
+		pr.write(e.Operator)
+		pr.operand(e.Right, prefix)
+
+	case *ast.InfixExpression:
+		// the operators are all left-associative, so on the right the
+		// same precedence needs parentheses too: a - (b - c)
+		p := precedence(e)
+		pr.operand(e.Left, p)
+		pr.write(" " + e.Operator + " ")
+		pr.operand(e.Right, p+1)
+
+	case *ast.IfExpression:
+		pr.write("if (")
+		pr.expression(e.Condition)
+		pr.write(") ")
+		pr.block(e.Consequence)
+		if e.Alternative != nil {
+			pr.write(" else ")
+			pr.block(e.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		params := make([]string, len(e.Parameters))
+		for i, param := range e.Parameters {
+			params[i] = param.Value
+		}
+		pr.write("fn(" + strings.Join(params, ", ") + ") ")
+		pr.block(e.Body)
+
+	case *ast.CallExpression:
+		pr.operand(e.Function, call)
+		pr.write("(")
+		for i, arg := range e.Arguments {
+			if i > 0 {
+				pr.write(", ")
+			}
+			pr.expression(arg)
+		}
+		pr.write(")")
+
+	case *ast.IndexExpression:
+		pr.operand(e.Left, call)
+		pr.write("[")
+		pr.expression(e.Index)
+		pr.write("]")
+
+	case *ast.ArrayLiteral:
+		pr.list("[", "]", e.Token, len(e.Elements), func(i int) ast.Expression { return e.Elements[i] }, func(i int) {
+			pr.expression(e.Elements[i])
+		})
+
+	case *ast.HashLiteral:
+		pr.list("{", "}", e.Token, len(e.Keys), func(i int) ast.Expression { return e.Keys[i] }, func(i int) {
+			pr.expression(e.Keys[i])
+			pr.write(": ")
+			pr.expression(e.Pairs[e.Keys[i]])
+		})
+	}
+}
+
+func (pr *printer) block(b *ast.BlockStatement) {
+	open := pr.indexOf(b.Token)
+	closing := pr.closing(open)
+	end := pr.tokens[closing]
+
+	if len(b.Statements) == 0 && !pr.commentsBetween(b.Token, end) {
+		pr.write("{}")
+		return
+	}
+
+	if b.Token.Line == end.Line && !pr.commentsBetween(b.Token, end) {
+		pr.write("{ ")
+		for i, stmt := range b.Statements {
+			var next ast.Statement
+			if i+1 < len(b.Statements) {
+				next = b.Statements[i+1]
+			}
+			if i > 0 {
+				pr.write(" ")
+			}
+			pr.statement(stmt, next, next == nil)
+		}
+		pr.write(" }")
+		return
+	}
+
+	pr.write("{")
+	pr.opened(b.Token, b.Statements)
+	pr.indent++
+	pr.newline()
+	first := pr.statements(b.Statements, end, true)
+	pr.flush(end, first)
+	pr.indent--
+	pr.newline()
+	pr.write("}")
+	pr.lastLine = end.Line
+}
+
+// a comment right after a { that starts a block of lines stays there
+func (pr *printer) opened(open token.Token, stmts []ast.Statement) {
+	if len(stmts) == 0 || firstToken(stmts[0]).Line > open.Line {
+		pr.trailing(open.Line)
+	}
+}
+
+/*
+list prints the elements of an array or hash between open and close, on
+one line if they were on one line in the source, otherwise one per line
+with the comments among them
+*/
+func (pr *printer) list(open, close string, start token.Token, n int, firstOf func(int) ast.Expression, element func(int)) {
+	openIndex := pr.indexOf(start)
+	end := pr.tokens[pr.closing(openIndex)]
+
+	if start.Line == end.Line || n == 0 {
+		pr.write(open)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				pr.write(", ")
+			}
+			element(i)
+		}
+		pr.write(close)
+		return
+	}
+
+	pr.write(open)
+	if firstToken(firstOf(0)).Line > start.Line {
+		pr.trailing(start.Line)
+	}
+	pr.indent++
+	for i := 0; i < n; i++ {
+		elementStart := firstToken(firstOf(i))
+		pr.flush(elementStart, false)
+		pr.newline()
+		element(i)
+
+		// the element ends with the , before the next one, or right before
+		// the closing bracket
+		last := pr.indexOf(end) - 1
+		if i+1 < n {
+			pr.write(",")
+			last = pr.after(firstOf(i+1)) - 1
+		}
+		if last >= 0 {
+			pr.lastLine = pr.tokens[last].Line
+			pr.trailing(pr.lastLine)
+		}
+	}
+	pr.flush(end, false)
+	pr.indent--
+	pr.newline()
+	pr.write(close)
+	pr.lastLine = end.Line
+}
+
+/*
+after is the index of the first token of a node that comes after a ; or a
+, - the next statement or element - so everything before it belongs to the
+one before. that's firstToken, unless the node starts with parentheses:
+they only group, the tree doesn't keep them, and (a + b) * c would have
+to start at a for the ( to be left with the statement before
+*/
+func (pr *printer) after(node ast.Node) int {
+	i := pr.indexOf(firstToken(node))
+	for i > 0 && pr.tokens[i-1].Type == token.LPAREN {
+		i--
+	}
+	return i
+}
+
+// firstToken is where a node starts in the source, which for an infix
+// expression, a call or an index isn't its own token but its left side's
+func firstToken(node ast.Node) token.Token {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token
+	case *ast.ReturnStatement:
+		return node.Token
+	case *ast.ExpressionStatement:
+		return firstToken(node.Expression)
+	case *ast.InfixExpression:
+		return firstToken(node.Left)
+	case *ast.CallExpression:
+		return firstToken(node.Function)
+	case *ast.IndexExpression:
+		return firstToken(node.Left)
+	case *ast.Identifier:
+		return node.Token
+	case *ast.IntegerLiteral:
+		return node.Token
+	case *ast.StringLiteral:
+		return node.Token
+	case *ast.Boolean:
+		return node.Token
+	case *ast.PrefixExpression:
+		return node.Token
+	case *ast.IfExpression:
+		return node.Token
+	case *ast.FunctionLiteral:
+		return node.Token
+	case *ast.ArrayLiteral:
+		return node.Token
+	case *ast.HashLiteral:
+		return node.Token
+	case *ast.BlockStatement:
+		return node.Token
+	}
+	return token.Token{}
+}
@@ -0,0 +1,170 @@
+package format
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let x=5", "let x = 5;\n"},
+		{"5+5", "5 + 5;\n"},
+		{"return   x*2", "return x * 2;\n"},
+		{"let s = \"hello world\";", "let s = \"hello world\";\n"},
+		{"let a = [1,2 , 3]; a[0]", "let a = [1, 2, 3];\na[0];\n"},
+		{"let h = {\"a\":1,true:fn(x){x}}", "let h = {\"a\": 1, true: fn(x) { x }};\n"},
+		{"let e = [];let h = {};", "let e = [];\nlet h = {};\n"},
+
+		// only the parentheses the precedence needs
+		{"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+		{"1 + (2 * 3)", "1 + 2 * 3;\n"},
+		{"(a - b) - c", "a - b - c;\n"},
+		{"a - (b - c)", "a - (b - c);\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"!(-a)", "!-a;\n"},
+		{"(-a)[0]", "(-a)[0];\n"},
+		{"(f(x))[0]", "f(x)[0];\n"},
+		{"(a < b) == (c > d)", "a < b == c > d;\n"},
+		{"(fn(x) { x })(5)", "fn(x) { x }(5);\n"},
+
+		// blocks keep the lines they had
+		{"let f = fn(a,b){a+b};", "let f = fn(a, b) { a + b };\n"},
+		{"let f = fn(){ let x = 1; x }", "let f = fn() { let x = 1; x };\n"},
+		{"let f = fn() {}", "let f = fn() {};\n"},
+		{
+			"let f = fn(x) {\n  if (x>1) {\n    return x;\n  } else { 0 }\n}",
+			"let f = fn(x) {\n\tif (x > 1) {\n\t\treturn x;\n\t} else { 0 }\n};\n",
+		},
+
+		// an if doesn't need a ; unless what comes next would carry on
+		// from it
+		{"if (a) { 1 }; puts(2);", "if (a) { 1 }\nputs(2);\n"},
+		{"if (a) { 1 }; (2)", "if (a) { 1 }\n2;\n"},
+		{"if (a) { 1 }; (-b)[0]", "if (a) { 1 };\n(-b)[0];\n"},
+		{"if (a) { 1 }; [2]", "if (a) { 1 };\n[2];\n"},
+		{"if (a) { 1 }; -2", "if (a) { 1 };\n-2;\n"},
+		{"if (a) { 1 }", "if (a) { 1 }\n"},
+
+		// a single blank line between statements is kept
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+
+		// arrays and hashes written over several lines get one element per
+		// line
+		{"let a = [1,\n2];", "let a = [\n\t1,\n\t2\n];\n"},
+		{"let h = {\n\"a\": 1, \"b\": 2}", "let h = {\n\t\"a\": 1,\n\t\"b\": 2\n};\n"},
+	}
+
+	for _, tt := range tests {
+		out, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) failed: %s", tt.input, err)
+			continue
+		}
+		if string(out) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nexpected=%q\ngot=     %q", tt.input, tt.expected, out)
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// just a comment", "// just a comment\n"},
+		{"// one\n\n\n// two   ", "// one\n\n// two\n"},
+		{"// adds\nlet add = fn(a, b) { a + b }; // two numbers\n", "// adds\nlet add = fn(a, b) { a + b }; // two numbers\n"},
+		{"let x = 1;\n// the end", "let x = 1;\n// the end\n"},
+		{
+			"let f = fn(x) { // doubles\n// inside\nx * 2 // twice\n// before the }\n}",
+			"let f = fn(x) { // doubles\n\t// inside\n\tx * 2 // twice\n\t// before the }\n};\n",
+		},
+		{
+			// a comment makes a block of one line into several
+			"if (x) { 1 } else { // never\n2 }",
+			"if (x) { 1 } else { // never\n\t2\n}\n",
+		},
+		{
+			"let a = [\n1, // one\n// two comes next\n2\n];",
+			"let a = [\n\t1, // one\n\t// two comes next\n\t2\n];\n",
+		},
+		{
+			// inside an expression that goes on one line there's no room
+			// for it, so the comment moves down to the next line
+			"puts(1, // one\n2);\nputs(3);",
+			"puts(1, 2);\n// one\nputs(3);\n",
+		},
+		{
+			// the parentheses of what comes next don't count as the line
+			// the comment is on
+			"x; // keep me here\n(a + b) * c;",
+			"x; // keep me here\n(a + b) * c;\n",
+		},
+		{
+			"let a = [\n1, // one\n((2 + 3)) * 4\n];",
+			"let a = [\n\t1, // one\n\t(2 + 3) * 4\n];\n",
+		},
+	}
+
+	for _, tt := range tests {
+		out, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) failed: %s", tt.input, err)
+			continue
+		}
+		if string(out) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nexpected=%q\ngot=     %q", tt.input, tt.expected, out)
+		}
+	}
+}
+
+// formatting what's already formatted changes nothing
+func TestSourceIsStable(t *testing.T) {
+	input := `
+// fib the slow way
+let fib = fn(n) {
+  if (n < 2) { return n; } // the base case
+  fib(n-1) + fib(n-2)
+};
+
+let config = {
+  "name": "monkey", // what it's called
+  "sizes": [1, 2,
+    3]
+};
+puts(fib(10), config["sizes"][2]) // 55 3
+`
+	once, err := Source([]byte(input))
+	if err != nil {
+		t.Fatalf("Source failed: %s", err)
+	}
+	twice, err := Source(once)
+	if err != nil {
+		t.Fatalf("Source failed on its own output: %s", err)
+	}
+	if string(once) != string(twice) {
+		t.Errorf("formatting again changed the output.\nonce=%q\ntwice=%q", once, twice)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source([]byte("let = 5;\nlet x 1;"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	var formatErr *Error
+	if !errors.As(err, &formatErr) {
+		t.Fatalf("error is not *Error. got=%T", err)
+	}
+	if len(formatErr.Errors) == 0 || formatErr.Errors[0].Line != 1 {
+		t.Errorf("wrong errors. got=%v", formatErr.Errors)
+	}
+	if got := err.Error(); got[:5] != "1:5: " {
+		t.Errorf("wrong message. got=%q", got)
+	}
+}
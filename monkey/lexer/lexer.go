@@ -1,12 +1,19 @@
 package lexer
 
-import "monkey/token"
+import (
+	"monkey/token"
+	"strings"
+)
 
 type Lexer struct {
 	input        string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+	line         int  // line of the current char, starting at 1
+	column       int  // column of the current char, starting at 1
+
+	comments []token.Token
 }
 
 /*
@@ -16,7 +23,7 @@ func New() *Lexer → Returns a pointer (standard practice for struct constructo
 
 // this is a package-level function that reates and returns a new *Lexer instance
 func New(input string) *Lexer { // *Lexer means that the function returns a pointer to a Lexer struct (rather than a Lexer value itself)
-	l := &Lexer{input: input} // creates a new Lexer struct instance and returns its memory address (a pointer to the struct)
+	l := &Lexer{input: input, line: 1} // creates a new Lexer struct instance and returns its memory address (a pointer to the struct)
 	l.readChar()
 	return l
 }
@@ -33,8 +40,17 @@ position in the input string
     incremented by one so that it always points to the next position we're
     going to read from and l.position always points to the position we
     last read
+  - line and column follow along so every token can say where it started;
+    stepping past a newline moves us to column 1 of the next line
 */
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -48,6 +64,13 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	for l.ch == '/' && l.peekChar() == '/' {
+		l.readComment()
+		l.skipWhitespace()
+	}
+
+	// remember where the token starts before we read past it
+	line, column := l.line, l.column
 
 	switch l.ch {
 	case '=':
@@ -70,6 +93,23 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RBRACE, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case '"':
+		str, ok := l.readString()
+		if ok {
+			tok.Type = token.STRING
+			tok.Literal = str
+		} else {
+			// keep the opening quote so the parser can tell this apart
+			// from an illegal character
+			tok.Type = token.ILLEGAL
+			tok.Literal = `"` + str
+		}
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
@@ -99,20 +139,40 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column = line, column
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 
+	tok.Line, tok.Column = line, column
+
 	l.readChar()
 	return tok
 }
 
+// Tokenize lexes the whole input in one go, for callers that want every
+// token at once (the REPL's highlighter, --tokens). the last token is
+// always the EOF
+func Tokenize(input string) []token.Token {
+	l := New(input)
+	tokens := []token.Token{}
+
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isLetter(l.ch) {
@@ -121,10 +181,46 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
+// reads everything up to the closing double quote and returns it without
+// the quotes. ok is false if the input ended before the string was closed
+func (l *Lexer) readString() (str string, ok bool) {
+	position := l.position + 1
+	for {
+		l.readChar()
+		if l.ch == '"' || l.ch == 0 {
+			break
+		}
+	}
+	return l.input[position:l.position], l.ch == '"'
+}
+
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
 
+/*
+a comment goes from // to the end of the line. the parser never sees it -
+NextToken skips comments like whitespace - but they're kept (with the
+// and where they start) for the tools that need them back, like the
+formatter
+*/
+func (l *Lexer) readComment() {
+	tok := token.Token{Type: token.COMMENT, Line: l.line, Column: l.column}
+
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	tok.Literal = strings.TrimRight(l.input[position:l.position], "\r")
+
+	l.comments = append(l.comments, tok)
+}
+
+// Comments returns the comments the lexer went past so far, in order
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
@@ -26,6 +26,10 @@ if (5 < 10) {
 
 10 == 10;
 10 != 9;
+"foobar"
+"foo bar"
+[1, 2];
+{"foo": "bar"}
 `
 
 	tests := []struct {
@@ -105,6 +109,19 @@ if (5 < 10) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
 		{token.EOF, ""},
 	}
 
@@ -124,3 +141,147 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x == "ab"
+`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.EQ, 2, 5},
+		{token.STRING, 2, 8},
+		{token.EOF, 3, 1},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	l := New(`let s = "abc`)
+
+	for i := 0; i < 3; i++ {
+		l.NextToken()
+	}
+
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != `"abc` {
+		t.Fatalf("wrong token for unterminated string. got=%+v", tok)
+	}
+
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("expected EOF after unterminated string. got=%+v", tok)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("let x = 5;")
+
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON, token.EOF}
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d", len(expected), len(tokens))
+	}
+
+	for i, tt := range expected {
+		if tokens[i].Type != tt {
+			t.Errorf("tokens[%d] - wrong type. expected=%q, got=%q", i, tt, tokens[i].Type)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// a comment\nlet x = 5; // five\r\nx / 2 //\n//last"
+
+	l := New(input)
+	expected := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH, token.INT, token.EOF,
+	}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tokens[%d] - wrong type. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+
+	comments := []struct {
+		literal      string
+		line, column int
+	}{
+		{"// a comment", 1, 1},
+		{"// five", 2, 12},
+		{"//", 3, 7},
+		{"//last", 4, 1},
+	}
+	got := l.Comments()
+	if len(got) != len(comments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(comments), len(got))
+	}
+	for i, c := range comments {
+		if got[i].Type != token.COMMENT || got[i].Literal != c.literal {
+			t.Errorf("comments[%d] - expected %q, got %q (%s)", i, c.literal, got[i].Literal, got[i].Type)
+		}
+		if got[i].Line != c.line || got[i].Column != c.column {
+			t.Errorf("comments[%d] - expected %d:%d, got %d:%d", i, c.line, c.column, got[i].Line, got[i].Column)
+		}
+	}
+}
+
+/*
+FuzzLexer checks that any input at all lexes to an EOF without panicking,
+and that it gets there: every token but EOF takes up at least one byte,
+so there can't be more of them than there are bytes
+
+	go test ./lexer -fuzz FuzzLexer
+*/
+func FuzzLexer(f *testing.F) {
+	for _, seed := range []string{
+		"let five = 5;\nlet add = fn(x, y) { x + y; };",
+		`"foo bar" "unterminated`,
+		"[1, 2]; {\"a\": 1}; !-/*5; 10 == 10; 10 != 9; // a comment",
+		"\x00\xff\t\r\n",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+
+		for i := 0; ; i++ {
+			if i > len(input) {
+				t.Fatalf("more than %d tokens from %d bytes", i, len(input))
+			}
+
+			tok := l.NextToken()
+			if tok.Line < 1 || tok.Column < 1 {
+				t.Fatalf("token %q at %d:%d", tok.Literal, tok.Line, tok.Column)
+			}
+			if tok.Type == token.EOF {
+				break
+			}
+		}
+	})
+}
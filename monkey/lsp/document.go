@@ -0,0 +1,194 @@
+package lsp
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// a document is an open file, parsed and indexed again every time it
+// changes
+type document struct {
+	uri   string
+	lines []string
+
+	tokens []token.Token
+	errors []parser.ParseError
+	index  *Index
+}
+
+func newDocument(uri, text string) *document {
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+
+	return &document{
+		uri:    uri,
+		lines:  strings.Split(text, "\n"),
+		tokens: lexer.Tokenize(text),
+		errors: p.ParseErrors(),
+		index:  NewIndex(program),
+	}
+}
+
+/*
+the lexer counts lines and columns from 1 and columns in bytes, the
+protocol counts both from 0 and characters in UTF-16 code units (what
+javascript strings are made of). so
+
+	let s = "héllo"; x
+
+has the x at column 19 for the lexer and character 17 for the editor
+*/
+func (d *document) position(line, column int) Position {
+	if line < 1 || line > len(d.lines) {
+		return Position{Line: max(line-1, 0)}
+	}
+
+	text := d.lines[line-1]
+	end := min(max(column-1, 0), len(text))
+	return Position{Line: line - 1, Character: utf16Len(text[:end])}
+}
+
+// the other way around: the lexer's line and column for pos
+func (d *document) offset(pos Position) (line, column int) {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return pos.Line + 1, 1
+	}
+
+	text := d.lines[pos.Line]
+	units := 0
+	for i, r := range text {
+		if units >= pos.Character {
+			return pos.Line + 1, i + 1
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return pos.Line + 1, len(text) + 1
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		n += len(utf16.Encode([]rune{r}))
+		s = s[size:]
+	}
+	return n
+}
+
+// the range a token covers (one that's on a single line, like all of them
+// but strings with a newline in them)
+func (d *document) tokenRange(tok token.Token) Range {
+	width := len(tok.Literal)
+	if tok.Type == token.STRING {
+		width += 2 // the quotes
+	}
+	return Range{
+		Start: d.position(tok.Line, tok.Column),
+		End:   d.position(tok.Line, tok.Column+width),
+	}
+}
+
+/*
+the AST only knows where things start, so where a statement ends comes
+from the tokens: from its first token, past the last one any node in
+the statement starts at, and then past whatever brackets are still open
+at that point - those are closed by the statement itself, like the } of
+a function. a ; right after is part of it too
+*/
+func (d *document) statementRange(stmt ast.Statement, start token.Token) Range {
+	last := start
+	lastOf(stmt, &last)
+
+	first := d.tokenIndex(start)
+	end := d.tokenIndex(last)
+	if first < 0 || end < 0 {
+		return d.tokenRange(start)
+	}
+
+	depth := 0
+	i := first
+	for ; i < len(d.tokens) && d.tokens[i].Type != token.EOF; i++ {
+		switch d.tokens[i].Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+		if i >= end && depth <= 0 {
+			break
+		}
+	}
+	if i+1 < len(d.tokens) && d.tokens[i+1].Type == token.SEMICOLON {
+		i++
+	}
+	if i >= len(d.tokens) || d.tokens[i].Type == token.EOF {
+		i--
+	}
+
+	return Range{Start: d.position(start.Line, start.Column), End: d.tokenRange(d.tokens[i]).End}
+}
+
+func (d *document) tokenIndex(tok token.Token) int {
+	for i, t := range d.tokens {
+		if t.Line == tok.Line && t.Column == tok.Column {
+			return i
+		}
+	}
+	return -1
+}
+
+func before(a, b token.Token) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// lastOf moves last on to the token furthest into the source that a node
+// under node starts with
+func lastOf(node ast.Node, last *token.Token) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		var tok token.Token
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			tok = node.Token
+		case *ast.ReturnStatement:
+			tok = node.Token
+		case *ast.ExpressionStatement:
+			tok = node.Token
+		case *ast.BlockStatement:
+			tok = node.Token
+		case *ast.Identifier:
+			tok = node.Token
+		case *ast.IntegerLiteral:
+			tok = node.Token
+		case *ast.StringLiteral:
+			tok = node.Token
+		case *ast.Boolean:
+			tok = node.Token
+		case *ast.PrefixExpression:
+			tok = node.Token
+		case *ast.InfixExpression:
+			tok = node.Token
+		case *ast.IfExpression:
+			tok = node.Token
+		case *ast.FunctionLiteral:
+			tok = node.Token
+		case *ast.CallExpression:
+			tok = node.Token
+		case *ast.ArrayLiteral:
+			tok = node.Token
+		case *ast.IndexExpression:
+			tok = node.Token
+		case *ast.HashLiteral:
+			tok = node.Token
+		}
+
+		if tok.Line > 0 && before(*last, tok) {
+			*last = tok
+		}
+		return true
+	})
+}
@@ -0,0 +1,184 @@
+package lsp
+
+import (
+	"monkey/ast"
+	"monkey/token"
+)
+
+/*
+the index knows, for every identifier in a program, which let or
+parameter it refers to - that's what go-to-definition and hover look up,
+and the lets (nested the way the functions they're in are) are the
+document's symbols
+
+names are scoped the way the evaluator scopes them: a function has a
+scope of its own, blocks don't. a name refers to the last definition
+before it, looking outwards from the scope it's used in. inside a
+function it can also refer to an outer definition that only comes after
+the function, since the function is only called once that's been
+defined:
+
+	let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+	let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+
+that last part is the evaluator's alone - the compiler resolves a name
+where it's used, so on the vm isOdd is an undefined name in isEven
+
+a let that binds a function is defined before the function itself, so
+the function can call itself
+*/
+type Index struct {
+	Symbols    []*Symbol    // the top level lets, in order
+	References []*Reference // every identifier, definitions included
+}
+
+type SymbolKind int
+
+const (
+	LetSymbol SymbolKind = iota
+	ParameterSymbol
+)
+
+type Symbol struct {
+	Name  string
+	Kind  SymbolKind
+	Token token.Token // where it's defined
+
+	Let      *ast.LetStatement    // for a let
+	Function *ast.FunctionLiteral // for a parameter, the function it's one of
+
+	Children []*Symbol // the lets in the function a let binds
+}
+
+// Symbol is nil for a name that isn't defined anywhere, which is either
+// a builtin or a mistake
+type Reference struct {
+	Token  token.Token
+	Symbol *Symbol
+}
+
+// NewIndex indexes a program, which doesn't have to have parsed without
+// errors - whatever the parser made of it is indexed
+func NewIndex(program *ast.Program) *Index {
+	b := &indexBuilder{index: &Index{}}
+	global := newScope(nil)
+
+	for _, stmt := range program.Statements {
+		b.walk(stmt, global, nil)
+	}
+
+	// the names used in a function that weren't defined yet when the walk
+	// got there, which an outer scope might define after all
+	for _, u := range b.unresolved {
+		for s := u.scope.outer; s != nil; s = s.outer {
+			if sym, ok := s.defs[u.ref.Token.Literal]; ok {
+				u.ref.Symbol = sym
+				break
+			}
+		}
+	}
+
+	return b.index
+}
+
+// At returns the identifier at the 1-based line and (byte) column, or nil
+// if there isn't one there
+func (ix *Index) At(line, column int) *Reference {
+	for _, ref := range ix.References {
+		tok := ref.Token
+		if tok.Line == line && column >= tok.Column && column < tok.Column+len(tok.Literal) {
+			return ref
+		}
+	}
+	return nil
+}
+
+type scope struct {
+	outer *scope
+	defs  map[string]*Symbol
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, defs: map[string]*Symbol{}}
+}
+
+func (s *scope) resolve(name string) (*Symbol, bool) {
+	for ; s != nil; s = s.outer {
+		if sym, ok := s.defs[name]; ok {
+			return sym, true
+		}
+	}
+	return nil, false
+}
+
+type indexBuilder struct {
+	index      *Index
+	unresolved []unresolved
+}
+
+type unresolved struct {
+	ref   *Reference
+	scope *scope
+}
+
+func (b *indexBuilder) define(sym *Symbol, s *scope, parent *Symbol) {
+	s.defs[sym.Name] = sym
+	b.index.References = append(b.index.References, &Reference{Token: sym.Token, Symbol: sym})
+
+	if sym.Kind != LetSymbol {
+		return
+	}
+	if parent != nil {
+		parent.Children = append(parent.Children, sym)
+	} else {
+		b.index.Symbols = append(b.index.Symbols, sym)
+	}
+}
+
+/*
+walk handles the nodes that define or use a name, and leaves going
+through the rest to ast.Inspect. parent is the let whose function the
+node is in, nil at the top level
+*/
+func (b *indexBuilder) walk(node ast.Node, s *scope, parent *Symbol) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name == nil {
+				b.walk(node.Value, s, parent)
+				return false
+			}
+
+			sym := &Symbol{Name: node.Name.Value, Kind: LetSymbol, Token: node.Name.Token, Let: node}
+			if fn, ok := node.Value.(*ast.FunctionLiteral); ok && fn != nil {
+				b.define(sym, s, parent)
+				b.walk(fn, s, sym)
+			} else {
+				// let x = x + 1 is about the x before it
+				b.walk(node.Value, s, parent)
+				b.define(sym, s, parent)
+			}
+			return false
+
+		case *ast.Identifier:
+			ref := &Reference{Token: node.Token}
+			if sym, ok := s.resolve(node.Value); ok {
+				ref.Symbol = sym
+			} else {
+				b.unresolved = append(b.unresolved, unresolved{ref: ref, scope: s})
+			}
+			b.index.References = append(b.index.References, ref)
+
+		case *ast.FunctionLiteral:
+			inner := newScope(s)
+			for _, param := range node.Parameters {
+				if param != nil {
+					b.define(&Symbol{Name: param.Value, Kind: ParameterSymbol, Token: param.Token, Function: node}, inner, parent)
+				}
+			}
+			b.walk(node.Body, inner, parent)
+			return false
+		}
+		return true
+	})
+}
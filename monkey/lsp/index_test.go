@@ -0,0 +1,94 @@
+package lsp
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestIndexResolves(t *testing.T) {
+	input := `let x = 1;
+let add = fn(a, b) { let sum = a + b; sum + x };
+let x = add(x, 2);
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { isEven(n) };
+len(y);`
+
+	tests := []struct {
+		line, column int
+		name         string
+		defLine      int // 0 if it doesn't refer to anything
+		defColumn    int
+	}{
+		{1, 5, "x", 1, 5},   // a definition refers to itself
+		{2, 32, "a", 2, 14}, // a parameter
+		{2, 40, "sum", 2, 26},
+		{2, 45, "x", 1, 5},      // the x before the function
+		{3, 5, "x", 3, 5},       // the new x
+		{3, 13, "x", 1, 5},      // the old x, on the right of the let
+		{3, 9, "add", 2, 5},     // a function
+		{4, 50, "isOdd", 5, 5},  // defined after the function that uses it
+		{5, 21, "isEven", 4, 5}, // the function the let binds can call itself
+		{6, 1, "len", 0, 0},     // a builtin
+		{6, 5, "y", 0, 0},       // not defined anywhere
+	}
+
+	p := parser.New(lexer.New(input))
+	ix := NewIndex(p.ParseProgram())
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	for _, tt := range tests {
+		ref := ix.At(tt.line, tt.column)
+		if ref == nil {
+			t.Errorf("%d:%d: no identifier", tt.line, tt.column)
+			continue
+		}
+		if ref.Token.Literal != tt.name {
+			t.Errorf("%d:%d: wrong identifier. want=%s, got=%s", tt.line, tt.column, tt.name, ref.Token.Literal)
+		}
+
+		if tt.defLine == 0 {
+			if ref.Symbol != nil {
+				t.Errorf("%d:%d: %s shouldn't refer to anything, got %d:%d", tt.line, tt.column, tt.name,
+					ref.Symbol.Token.Line, ref.Symbol.Token.Column)
+			}
+			continue
+		}
+		if ref.Symbol == nil {
+			t.Errorf("%d:%d: %s refers to nothing", tt.line, tt.column, tt.name)
+			continue
+		}
+		if ref.Symbol.Token.Line != tt.defLine || ref.Symbol.Token.Column != tt.defColumn {
+			t.Errorf("%d:%d: %s refers to the wrong definition. want=%d:%d, got=%d:%d", tt.line, tt.column, tt.name,
+				tt.defLine, tt.defColumn, ref.Symbol.Token.Line, ref.Symbol.Token.Column)
+		}
+	}
+
+	if ref := ix.At(2, 20); ref != nil {
+		t.Errorf("2:20 is the { of the function, got %s", ref.Token.Literal)
+	}
+
+	names := []string{}
+	for _, sym := range ix.Symbols {
+		names = append(names, sym.Name)
+	}
+	if len(names) != 5 || names[1] != "add" || len(ix.Symbols[1].Children) != 1 || ix.Symbols[1].Children[0].Name != "sum" {
+		t.Errorf("wrong symbols. got=%v", names)
+	}
+}
+
+// whatever did parse of a broken program is still indexed
+func TestIndexBrokenProgram(t *testing.T) {
+	p := parser.New(lexer.New("let f = fn(a) { a + };\nlet = 3;\nf(1)"))
+	ix := NewIndex(p.ParseProgram())
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+
+	ref := ix.At(3, 1)
+	if ref == nil || ref.Symbol == nil || ref.Symbol.Token.Line != 1 {
+		t.Errorf("f should still refer to the let on line 1. got=%+v", ref)
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Package lsp is a language server for monkey, so editors can show the
+errors in a file while it's being written and jump around in it:
+
+  - diagnostics: the parser's errors, every time a file changes
+  - go to definition: from a name to the let or parameter it refers to
+  - hover: what a name is - the let it was defined with, a parameter, a
+    builtin
+  - document symbols: the lets, nested by the functions they're in
+
+it speaks the protocol over stdin and stdout (see Serve), which is what
+`monkey lsp` does for an editor to start it
+*/
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/object"
+	"strings"
+	"unicode/utf8"
+)
+
+type Server struct {
+	out       io.Writer
+	documents map[string]*document
+
+	shutdown bool // a shutdown request came in, so exit is expected
+}
+
+func NewServer(out io.Writer) *Server {
+	return &Server{out: out, documents: map[string]*document{}}
+}
+
+// ErrNoShutdown is what Serve returns when the client said exit without
+// asking the server to shut down first, which the protocol counts as a
+// failure
+var ErrNoShutdown = errors.New("exit without shutdown")
+
+/*
+Serve reads messages from in and answers them on out until the client
+sends exit or in runs out. a message that isn't JSON gets an error
+response, a header that can't be read ends it
+*/
+func Serve(in io.Reader, out io.Writer) error {
+	s := NewServer(out)
+	r := bufio.NewReader(in)
+
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		done, err := s.Handle(body)
+		if err != nil {
+			return err
+		}
+		if done {
+			if !s.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+	}
+}
+
+// Handle deals with one message (without its header) and reports whether
+// it was the exit notification. the error is only ever one writing to out
+func (s *Server) Handle(body []byte) (exit bool, err error) {
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return false, s.respondError(json.RawMessage("null"), codeParseError, err.Error())
+	}
+
+	isRequest := len(msg.ID) > 0
+	if msg.Method == "" {
+		// a response to something the server never asks
+		return false, nil
+	}
+
+	switch msg.Method {
+	case "exit":
+		return true, nil
+	case "initialized", "$/cancelRequest", "$/setTrace":
+		return false, nil
+	case "textDocument/didOpen", "textDocument/didChange", "textDocument/didClose":
+		return false, s.handleDocument(msg)
+	}
+
+	if !isRequest {
+		// notifications nobody here knows can be ignored
+		return false, nil
+	}
+
+	result, rpcErr := s.handleRequest(msg)
+	if rpcErr != nil {
+		return false, s.respondError(msg.ID, rpcErr.Code, rpcErr.Message)
+	}
+	return false, s.respond(msg.ID, result)
+}
+
+func (s *Server) handleRequest(msg message) (interface{}, *responseError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1, // the whole text on every change
+				"definitionProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "monkey"},
+		}, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return s.definition(params), nil
+
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return s.hover(params), nil
+
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return s.documentSymbols(params), nil
+	}
+
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+func (s *Server) handleDocument(msg message) error {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		// with full sync the last change is the whole text
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return s.update(params.TextDocument.URI, text)
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.documents, params.TextDocument.URI)
+		// the errors of a file that isn't open anymore shouldn't stick around
+		return s.notify("textDocument/publishDiagnostics",
+			PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+	}
+	return nil
+}
+
+func (s *Server) update(uri, text string) error {
+	doc := newDocument(uri, text)
+	s.documents[uri] = doc
+
+	return s.notify("textDocument/publishDiagnostics",
+		PublishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics()})
+}
+
+// the parser only knows where an error starts, so the range is the one
+// character there (or the end of the line, right after it)
+func (d *document) diagnostics() []Diagnostic {
+	diags := []Diagnostic{}
+	for _, err := range d.errors {
+		start := d.position(err.Line, err.Column)
+		end := d.position(err.Line, err.Column+1)
+		diags = append(diags, Diagnostic{
+			Range:    Range{Start: start, End: end},
+			Severity: severityError,
+			Source:   "monkey",
+			Message:  err.Message,
+		})
+	}
+	return diags
+}
+
+// the identifier under pos, if pos is in an open document that has one
+func (s *Server) referenceAt(params TextDocumentPositionParams) (*document, *Reference) {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+
+	line, column := doc.offset(params.Position)
+	return doc, doc.index.At(line, column)
+}
+
+// a Location, or nil (null) when there's no definition to go to
+func (s *Server) definition(params TextDocumentPositionParams) interface{} {
+	doc, ref := s.referenceAt(params)
+	if ref == nil || ref.Symbol == nil {
+		return nil
+	}
+	return Location{URI: doc.uri, Range: doc.tokenRange(ref.Symbol.Token)}
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) interface{} {
+	doc, ref := s.referenceAt(params)
+	if ref == nil {
+		return nil
+	}
+
+	var text string
+	switch {
+	case ref.Symbol != nil:
+		text = describe(ref.Symbol)
+	case object.GetBuiltinByName(ref.Token.Literal) != nil:
+		text = "builtin " + ref.Token.Literal
+	default:
+		return nil
+	}
+
+	r := doc.tokenRange(ref.Token)
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```monkey\n" + text + "\n```"},
+		Range:    &r,
+	}
+}
+
+// longer values than this are cut short in a hover
+const maxHoverValue = 60
+
+// what hovering over a name shows: how it was defined, e.g.
+// let add = fn(a, b) or fn(a, b) parameter a
+func describe(sym *Symbol) string {
+	switch sym.Kind {
+	case ParameterSymbol:
+		name := sym.Function.Name
+		if name == "" {
+			name = "fn"
+		}
+		return fmt.Sprintf("%s parameter %s", signature(name, sym.Function), sym.Name)
+	}
+
+	value := sym.Let.Value
+	if fn, ok := value.(*ast.FunctionLiteral); ok && fn != nil {
+		return "let " + sym.Name + " = " + signature("fn", fn)
+	}
+	if ast.IsNil(value) {
+		return "let " + sym.Name
+	}
+
+	s := value.String()
+	if len(s) > maxHoverValue {
+		// not in the middle of a character
+		end := maxHoverValue
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		s = s[:end] + "..."
+	}
+	return "let " + sym.Name + " = " + s
+}
+
+func signature(name string, fn *ast.FunctionLiteral) string {
+	params := []string{}
+	for _, p := range fn.Parameters {
+		if p != nil {
+			params = append(params, p.Value)
+		}
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+func (s *Server) documentSymbols(params DocumentSymbolParams) interface{} {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return []DocumentSymbol{}
+	}
+	return doc.symbols(doc.index.Symbols)
+}
+
+func (d *document) symbols(syms []*Symbol) []DocumentSymbol {
+	result := []DocumentSymbol{}
+	for _, sym := range syms {
+		ds := DocumentSymbol{
+			Name:           sym.Name,
+			Kind:           symbolKindVariable,
+			Range:          d.statementRange(sym.Let, sym.Let.Token),
+			SelectionRange: d.tokenRange(sym.Token),
+		}
+		if fn, ok := sym.Let.Value.(*ast.FunctionLiteral); ok && fn != nil {
+			ds.Kind = symbolKindFunction
+			ds.Detail = signature("fn", fn)
+		}
+		if len(sym.Children) > 0 {
+			ds.Children = d.symbols(sym.Children)
+		}
+		result = append(result, ds)
+	}
+	return result
+}
+
+func (s *Server) respond(id json.RawMessage, result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return s.respondError(id, codeInternalError, err.Error())
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: id, Result: data})
+}
+
+func (s *Server) respondError(id json.RawMessage, code int, message string) error {
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: id, Error: &responseError{Code: code, Message: message}})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
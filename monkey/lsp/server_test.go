@@ -0,0 +1,288 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// a session with the server: everything the client sends at once, then
+// whatever came back
+func serve(t *testing.T, msgs ...string) ([]map[string]interface{}, error) {
+	t.Helper()
+
+	var in bytes.Buffer
+	for _, msg := range msgs {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+
+	var out bytes.Buffer
+	err := Serve(&in, &out)
+
+	replies := []map[string]interface{}{}
+	r := bufio.NewReader(&out)
+	for {
+		body, readErr := readMessage(r)
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			t.Fatalf("bad message from the server: %s", readErr)
+		}
+
+		var reply map[string]interface{}
+		if err := json.Unmarshal(body, &reply); err != nil {
+			t.Fatalf("bad JSON from the server: %s", err)
+		}
+		replies = append(replies, reply)
+	}
+	return replies, err
+}
+
+func open(uri, text string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":%q,"languageId":"monkey","version":1,"text":%q}}}`, uri, text)
+}
+
+func request(id int, method, uri string, line, character int) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":{"textDocument":{"uri":%q},"position":{"line":%d,"character":%d}}}`,
+		id, method, uri, line, character)
+}
+
+const (
+	shutdown = `{"jsonrpc":"2.0","id":99,"method":"shutdown"}`
+	exit     = `{"jsonrpc":"2.0","method":"exit"}`
+)
+
+// encodes v the way it came back from the server, to compare against
+func asJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestInitializeAndShutdown(t *testing.T) {
+	replies, err := serve(t, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/formatting","params":{}}`,
+		`not json`,
+		shutdown, exit)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(replies) != 4 {
+		t.Fatalf("wrong number of replies. want=4, got=%d: %v", len(replies), replies)
+	}
+
+	caps := asJSON(t, replies[0]["result"].(map[string]interface{})["capabilities"])
+	if caps != `{"definitionProvider":true,"documentSymbolProvider":true,"hoverProvider":true,"textDocumentSync":1}` {
+		t.Errorf("wrong capabilities. got=%s", caps)
+	}
+
+	if got := asJSON(t, replies[1]); got != `{"error":{"code":-32601,"message":"method not found: textDocument/formatting"},"id":2,"jsonrpc":"2.0"}` {
+		t.Errorf("wrong reply to an unknown method. got=%s", got)
+	}
+	if code := replies[2]["error"].(map[string]interface{})["code"]; code != float64(codeParseError) {
+		t.Errorf("wrong reply to a message that isn't JSON. got=%v", replies[2])
+	}
+
+	// the result of shutdown is null, but it has to be there
+	if result, ok := replies[3]["result"]; !ok || result != nil {
+		t.Errorf("wrong reply to shutdown. got=%v", replies[3])
+	}
+
+	if _, err := serve(t, exit); !errors.Is(err, ErrNoShutdown) {
+		t.Errorf("exit without shutdown should be ErrNoShutdown. got=%v", err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	replies, err := serve(t,
+		open("file:///a.mky", "let x = 1;\nlet = 2;"),
+		`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"file:///a.mky","version":2},"contentChanges":[{"text":"let x = 1;"}]}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didClose","params":{"textDocument":{"uri":"file:///a.mky"}}}`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(replies) != 3 {
+		t.Fatalf("wrong number of replies. want=3, got=%d", len(replies))
+	}
+
+	for _, reply := range replies {
+		if reply["method"] != "textDocument/publishDiagnostics" {
+			t.Fatalf("expected diagnostics. got=%v", reply)
+		}
+	}
+
+	diags := replies[0]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	if len(diags) == 0 {
+		t.Fatalf("expected diagnostics for the broken let")
+	}
+	expected := `{"message":"expected next token to be IDENT, got = instead","range":{"end":{"character":5,"line":1},"start":{"character":4,"line":1}},"severity":1,"source":"monkey"}`
+	if got := asJSON(t, diags[0]); got != expected {
+		t.Errorf("wrong diagnostic.\nwant=%s\n got=%s", expected, got)
+	}
+
+	// fixing the file and closing it both clear them
+	for _, reply := range replies[1:] {
+		if got := asJSON(t, reply["params"]); got != `{"diagnostics":[],"uri":"file:///a.mky"}` {
+			t.Errorf("diagnostics should be empty. got=%s", got)
+		}
+	}
+}
+
+const program = `let greeting = "héllo";
+let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+add(len(greeting), 1)`
+
+func TestDefinition(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{5, 0, `{"range":{"end":{"character":7,"line":1},"start":{"character":4,"line":1}},"uri":"file:///a.mky"}`},
+		{2, 12, `{"range":{"end":{"character":14,"line":1},"start":{"character":13,"line":1}},"uri":"file:///a.mky"}`},
+		{5, 10, `{"range":{"end":{"character":12,"line":0},"start":{"character":4,"line":0}},"uri":"file:///a.mky"}`},
+		{5, 4, "null"},  // len is a builtin
+		{0, 16, "null"}, // inside the string
+	}
+
+	for _, tt := range tests {
+		replies, err := serve(t, open("file:///a.mky", program), request(1, "textDocument/definition", "file:///a.mky", tt.line, tt.character))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := asJSON(t, replies[1]["result"]); got != tt.expected {
+			t.Errorf("%d:%d: wrong definition.\nwant=%s\n got=%s", tt.line, tt.character, tt.expected, got)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{5, 0, "let add = fn(a, b)"},
+		{2, 12, "add(a, b) parameter a"},
+		{4, 0, ""},
+		{5, 4, "builtin len"},
+		{3, 2, "let sum = (a + b)"},
+		{5, 8, `let greeting = héllo`},
+	}
+
+	for _, tt := range tests {
+		replies, err := serve(t, open("file:///a.mky", program), request(1, "textDocument/hover", "file:///a.mky", tt.line, tt.character))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		result := replies[1]["result"]
+		if tt.expected == "" {
+			if result != nil {
+				t.Errorf("%d:%d: expected no hover. got=%v", tt.line, tt.character, result)
+			}
+			continue
+		}
+		if result == nil {
+			t.Errorf("%d:%d: no hover", tt.line, tt.character)
+			continue
+		}
+
+		value := result.(map[string]interface{})["contents"].(map[string]interface{})["value"]
+		if value != "```monkey\n"+tt.expected+"\n```" {
+			t.Errorf("%d:%d: wrong hover. want=%q, got=%q", tt.line, tt.character, tt.expected, value)
+		}
+	}
+}
+
+// a long value is cut short, but not in the middle of a character
+func TestHoverLongValue(t *testing.T) {
+	long := strings.Repeat("a", maxHoverValue-1) + "é" + strings.Repeat("b", 10)
+	src := fmt.Sprintf("let s = %q;\ns", long)
+
+	replies, err := serve(t, open("file:///a.mky", src), request(1, "textDocument/hover", "file:///a.mky", 1, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	value := replies[1]["result"].(map[string]interface{})["contents"].(map[string]interface{})["value"]
+	expected := "```monkey\nlet s = " + strings.Repeat("a", maxHoverValue-1) + "...\n```"
+	if value != expected {
+		t.Errorf("wrong hover. want=%q, got=%q", expected, value)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	replies, err := serve(t, open("file:///a.mky", program),
+		`{"jsonrpc":"2.0","id":1,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"file:///a.mky"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"file:///b.mky"}}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := strings.Join([]string{
+		`[{"name":"greeting","kind":13,`,
+		`"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":23}},`,
+		`"selectionRange":{"start":{"line":0,"character":4},"end":{"line":0,"character":12}}},`,
+		`{"name":"add","detail":"fn(a, b)","kind":12,`,
+		`"range":{"start":{"line":1,"character":0},"end":{"line":4,"character":2}},`,
+		`"selectionRange":{"start":{"line":1,"character":4},"end":{"line":1,"character":7}},`,
+		`"children":[{"name":"sum","kind":13,`,
+		`"range":{"start":{"line":2,"character":2},"end":{"line":2,"character":18}},`,
+		`"selectionRange":{"start":{"line":2,"character":6},"end":{"line":2,"character":9}}}]}]`,
+	}, "")
+
+	var symbols []DocumentSymbol
+	if err := json.Unmarshal([]byte(asJSON(t, replies[1]["result"])), &symbols); err != nil {
+		t.Fatal(err)
+	}
+	if got := asJSON(t, symbols); got != expected {
+		t.Errorf("wrong symbols.\nwant=%s\n got=%s", expected, got)
+	}
+
+	// a document that isn't open has none
+	if got := asJSON(t, replies[2]["result"]); got != "[]" {
+		t.Errorf("wrong symbols for a closed document. got=%s", got)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	doc := newDocument("file:///a.mky", "let s = \"héllo\"; x\n𝄞 y")
+
+	tests := []struct {
+		line, column int
+		expected     Position
+	}{
+		{1, 1, Position{0, 0}},
+		{1, 19, Position{0, 17}},
+		{2, 6, Position{1, 3}}, // 𝄞 is 4 bytes and 2 UTF-16 units
+		{2, 99, Position{1, 4}},
+	}
+
+	for _, tt := range tests {
+		pos := doc.position(tt.line, tt.column)
+		if pos != tt.expected {
+			t.Errorf("%d:%d: wrong position. want=%+v, got=%+v", tt.line, tt.column, tt.expected, pos)
+		}
+
+		if tt.column > 20 {
+			continue
+		}
+		line, column := doc.offset(pos)
+		if line != tt.line || column != tt.column {
+			t.Errorf("%+v: wrong offset. want=%d:%d, got=%d:%d", pos, tt.line, tt.column, line, column)
+		}
+	}
+}
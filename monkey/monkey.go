@@ -0,0 +1,426 @@
+/*
+Package monkey is for embedding the interpreter in a go program, without
+having to put the lexer, parser and evaluator together yourself:
+
+	interp := monkey.New(monkey.WithStdout(&out), monkey.WithTimeout(time.Second))
+
+	if _, err := interp.Eval(`let double = fn(x) { x * 2 };`); err != nil {
+		return err
+	}
+	v, err := interp.Eval(`double(21)`) // v.String() is "42"
+
+every Eval carries on where the one before left off, so what one program
+defines with let the next one can use - like typing them into the REPL
+one after the other. a program that fails still keeps what it defined up
+to the error, again like in the REPL (on the vm only if it got to every
+let it has - a name can't be half defined there)
+
+data goes in and out as plain go values: Set defines a global from a
+map, slice, struct and so on, and Value.Decode turns what a program
+returned back into one (see ToValue and FromValue). RegisterFunc makes
+a go function something programs can call, with its arguments and
+results converted the same way
+
+	interp.Set("user", User{Name: "ann", Age: 37})
+	v, _ := interp.Eval(`user["Age"] + 1`)
+	var age int
+	v.Decode(&age) // 38
+
+by default programs run on the evaluator, have all the builtins and no
+limits. the options change that: WithVM runs them on the bytecode vm
+instead, WithStdout and WithoutBuiltins decide what a program gets to
+touch, and WithMaxDepth, WithMaxLength and WithTimeout keep one that never
+finishes (or never stops growing) from taking the host down with it
+
+an Interpreter is not safe to use from more than one goroutine at a time
+*/
+package monkey
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"strings"
+	"time"
+)
+
+type Interpreter struct {
+	stdout    io.Writer
+	disabled  []string
+	maxDepth  int
+	maxLength int
+	timeout   time.Duration
+	useVM     bool
+
+	limits *object.Limits // nil when there aren't any
+
+	// the evaluator's state
+	env *object.Environment
+
+	// the vm's: what the compiler knows about the globals, and the globals
+	symbols   *compiler.SymbolTable
+	constants []object.Object
+	globals   []object.Object
+}
+
+type Option func(*Interpreter)
+
+// WithStdout sends what puts writes to w instead of os.Stdout
+func WithStdout(w io.Writer) Option {
+	return func(interp *Interpreter) { interp.stdout = w }
+}
+
+// WithoutBuiltins takes builtins away from the programs: calling one of
+// them is an error. names that aren't builtins are ignored
+func WithoutBuiltins(names ...string) Option {
+	return func(interp *Interpreter) { interp.disabled = append(interp.disabled, names...) }
+}
+
+// WithMaxDepth stops a program once its calls nest deeper than n, which
+// is what runaway recursion runs into
+func WithMaxDepth(n int) Option {
+	return func(interp *Interpreter) { interp.maxDepth = n }
+}
+
+// WithMaxLength stops a program that makes a string longer than n bytes
+// or an array with more than n elements, before it eats all the memory.
+// what puts prints, and a failed assert's message, can't be longer than n
+// bytes either
+func WithMaxLength(n int) Option {
+	return func(interp *Interpreter) { interp.maxLength = n }
+}
+
+// WithTimeout stops a program that's still running after d, printing and
+// comparing with assert_eq included. every call to Eval gets d of its own
+func WithTimeout(d time.Duration) Option {
+	return func(interp *Interpreter) { interp.timeout = d }
+}
+
+// WithVM compiles programs to bytecode and runs them on the vm. the one
+// difference to the evaluator is that undefined names are reported before
+// anything runs
+func WithVM() Option {
+	return func(interp *Interpreter) { interp.useVM = true }
+}
+
+func New(opts ...Option) *Interpreter {
+	interp := &Interpreter{stdout: os.Stdout}
+	for _, opt := range opts {
+		opt(interp)
+	}
+
+	if interp.maxDepth > 0 || interp.maxLength > 0 || interp.timeout > 0 {
+		interp.limits = &object.Limits{MaxDepth: interp.maxDepth, MaxLength: interp.maxLength}
+	}
+
+	if interp.useVM {
+		interp.symbols = compiler.NewSymbolTable()
+		for i, v := range object.Builtins {
+			interp.symbols.DefineBuiltin(i, v.Name)
+		}
+		interp.constants = []object.Object{}
+		interp.globals = make([]object.Object, vm.GlobalsSize)
+	} else {
+		interp.env = object.NewEnvironment()
+		interp.env.SetLimits(interp.limits)
+	}
+
+	interp.define("puts", putsTo(interp.stdout, interp.limits))
+	if interp.limits != nil {
+		interp.define("assert", object.NewAssert(interp.limits))
+		interp.define("assert_eq", object.NewAssertEq(interp.limits))
+	}
+	for _, name := range interp.disabled {
+		if object.GetBuiltinByName(name) != nil {
+			interp.define(name, disabledBuiltin(name))
+		}
+	}
+
+	return interp
+}
+
+/*
+the capabilities are globals with the builtins' names, which take
+precedence over the builtins themselves on both engines. a program can
+still define its own puts, it just can't get at the real one around the
+interpreter's back
+*/
+func (interp *Interpreter) define(name string, obj object.Object) {
+	if interp.useVM {
+		// a global that's already there is set again, so the functions that
+		// use it see the new value - like they would on the evaluator
+		symbol, ok := interp.symbols.Resolve(name)
+		if !ok || symbol.Scope != compiler.GlobalScope {
+			symbol = interp.symbols.Define(name)
+		}
+		interp.globals[symbol.Index] = obj
+	} else {
+		interp.env.Set(name, obj)
+	}
+}
+
+// with limits what puts prints counts against them too, see
+// object.Limits.Inspect
+func putsTo(w io.Writer, limits *object.Limits) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		for _, arg := range args {
+			if limits == nil {
+				fmt.Fprintln(w, arg.Inspect())
+				continue
+			}
+
+			text, err := limits.Inspect(arg)
+			if err != nil {
+				return &object.Error{Message: err.Error()}
+			}
+			fmt.Fprintln(w, text)
+		}
+		return nil
+	}}
+}
+
+func disabledBuiltin(name string) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return &object.Error{Message: fmt.Sprintf("builtin %s is disabled", name)}
+	}}
+}
+
+// Set defines a global called name for the programs that run from now on,
+// with v converted by ToValue
+func (interp *Interpreter) Set(name string, v any) error {
+	obj, err := ToValue(v)
+	if err != nil {
+		return err
+	}
+	interp.define(name, obj)
+	return nil
+}
+
+// Eval runs src and returns the value of its last expression, which is
+// null when the program ends in a let. a program that doesn't parse is a
+// *SyntaxError, one that fails while running an *Error
+func (interp *Interpreter) Eval(src string) (Value, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		syntaxErr := &SyntaxError{}
+		for _, err := range p.ParseErrors() {
+			syntaxErr.Errors = append(syntaxErr.Errors, Error{Message: err.Message, Line: err.Line, Column: err.Column})
+		}
+		return Value{}, syntaxErr
+	}
+
+	if interp.limits != nil {
+		interp.limits.Reset()
+		interp.limits.Deadline = time.Time{}
+		if interp.timeout > 0 {
+			interp.limits.Deadline = time.Now().Add(interp.timeout)
+		}
+	}
+
+	var result object.Object
+	var err error
+	if interp.useVM {
+		result, err = interp.runVM(program)
+	} else {
+		result, err = interp.runEval(program)
+	}
+	if err != nil {
+		return Value{}, err
+	}
+
+	// the vm would still have the last value it popped lying around
+	if n := len(program.Statements); n > 0 {
+		if _, isLet := program.Statements[n-1].(*ast.LetStatement); isLet {
+			return Value{}, nil
+		}
+	}
+
+	return Value{obj: result, maxLength: interp.maxLength, timeout: interp.timeout}, nil
+}
+
+func (interp *Interpreter) runEval(program *ast.Program) (object.Object, error) {
+	result := evaluator.Eval(program, interp.env)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &Error{Message: errObj.Message, Line: errObj.Line, Column: errObj.Column}
+	}
+	return result, nil
+}
+
+// OpConstant has a two byte operand
+const maxConstants = 1 << 16
+
+/*
+the compiler defines names as it goes, and a global only gets its value
+once the program runs up to its let. if the program doesn't get that far
+(it doesn't compile, or fails before the let) the name would be left
+pointing at a global that was never set, so then everything this program
+defined is thrown away again
+
+a program that finishes can still skip a let, when it's in a branch that
+didn't run. those names are null from then on, rather than a global the
+vm can't do anything with
+*/
+func (interp *Interpreter) runVM(program *ast.Program) (object.Object, error) {
+	symbols := interp.symbols.Copy()
+
+	comp := compiler.NewWithState(symbols, interp.constants)
+	if err := comp.Compile(program); err != nil {
+		var compileErr *compiler.Error
+		if errors.As(err, &compileErr) {
+			return nil, &Error{Message: compileErr.Message, Line: compileErr.Line, Column: compileErr.Column}
+		}
+		return nil, &Error{Message: err.Error()}
+	}
+
+	/*
+		the compiler won't emit an index that doesn't fit its instruction, but
+		the globals and constants are the interpreter's, and pile up over every
+		program Eval has seen. a program that takes them past what the vm can
+		address is an error before it does anything, rather than a panic
+		halfway through
+	*/
+	if symbols.NumDefinitions() > vm.GlobalsSize {
+		return nil, &Error{Message: fmt.Sprintf("too many globals (the most there can be is %d)", vm.GlobalsSize)}
+	}
+	bytecode := comp.Bytecode()
+	if len(bytecode.Constants) > maxConstants {
+		return nil, &Error{Message: fmt.Sprintf("too many constants (the most there can be is %d)", maxConstants)}
+	}
+	interp.constants = bytecode.Constants
+
+	machine := vm.NewWithGlobalsState(bytecode, interp.globals)
+	if interp.limits != nil {
+		machine.SetLimits(interp.limits)
+	}
+	runErr := machine.Run()
+
+	if runErr == nil {
+		for i := interp.symbols.NumDefinitions(); i < symbols.NumDefinitions(); i++ {
+			if interp.globals[i] == nil {
+				interp.globals[i] = vm.Null
+			}
+		}
+	}
+	if runErr == nil || interp.allSet(symbols) {
+		interp.symbols = symbols
+	}
+
+	if runErr != nil {
+		var vmErr *vm.Error
+		if errors.As(runErr, &vmErr) {
+			return nil, &Error{Message: vmErr.Message, Line: vmErr.Line, Column: vmErr.Column}
+		}
+		return nil, &Error{Message: runErr.Error()}
+	}
+
+	return machine.LastPoppedStackElem(), nil
+}
+
+// allSet reports whether every global symbols has on top of the current
+// ones got a value
+func (interp *Interpreter) allSet(symbols *compiler.SymbolTable) bool {
+	for i := interp.symbols.NumDefinitions(); i < symbols.NumDefinitions(); i++ {
+		if interp.globals[i] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Value is what a program evaluated to. the zero Value is null
+type Value struct {
+	obj object.Object
+
+	// the limits of the interpreter it came from, for String
+	maxLength int
+	timeout   time.Duration
+}
+
+/*
+String is the value the way the REPL would show it. an array made of the
+same array over and over is small, but its text doesn't have to be - with
+WithMaxLength or WithTimeout, String stops at the length or after the time
+like puts would, and ends what it got to in "..."
+*/
+func (v Value) String() string {
+	if v.obj == nil {
+		return "null"
+	}
+	if v.maxLength <= 0 && v.timeout <= 0 {
+		return v.obj.Inspect()
+	}
+
+	limits := &object.Limits{MaxLength: v.maxLength}
+	if v.timeout > 0 {
+		limits.Deadline = time.Now().Add(v.timeout)
+	}
+	text, err := limits.Inspect(v.obj)
+	if err != nil {
+		return text + "..."
+	}
+	return text
+}
+
+// Type is the name of the value's type, like INTEGER or STRING
+func (v Value) Type() string {
+	if v.obj == nil {
+		return string(object.NULL_OBJ)
+	}
+	return string(v.obj.Type())
+}
+
+func (v Value) IsNull() bool {
+	return v.obj == nil || v.obj.Type() == object.NULL_OBJ
+}
+
+// Object is the object behind the value, for FromValue
+func (v Value) Object() object.Object {
+	if v.obj == nil {
+		return object.NULL
+	}
+	return v.obj
+}
+
+// Decode stores the value in what dst points to, see FromValue
+func (v Value) Decode(dst any) error {
+	return FromValue(v.Object(), dst)
+}
+
+// Error is a program that failed while running (on the vm, also one that
+// didn't compile), with the position of the expression that failed
+type Error struct {
+	Message string
+	Line    int // 0 if the position isn't known
+	Column  int
+}
+
+func (e *Error) Error() string {
+	if e.Line <= 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// SyntaxError has every error the parser found in a program
+type SyntaxError struct {
+	Errors []Error
+}
+
+func (e *SyntaxError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i := range e.Errors {
+		msgs[i] = e.Errors[i].Error()
+	}
+	return strings.Join(msgs, "\n")
+}
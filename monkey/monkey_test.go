@@ -0,0 +1,329 @@
+package monkey
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// every test runs on both engines, they have to behave the same
+func engines(opts ...Option) map[string]*Interpreter {
+	return map[string]*Interpreter{
+		"eval": New(opts...),
+		"vm":   New(append(opts, WithVM())...),
+	}
+}
+
+func TestEvalKeepsState(t *testing.T) {
+	steps := []struct {
+		input    string
+		expected string
+	}{
+		{"let double = fn(x) { x * 2 };", "null"},
+		{"let x = double(21);", "null"},
+		{"x", "42"},
+		{`let greet = fn(name) { "hi " + name }; greet("monkey")`, "hi monkey"},
+		{"let x = x + 1; [x, double(x)]", "[43, 86]"},
+		{"", "null"},
+	}
+
+	for name, interp := range engines() {
+		for _, step := range steps {
+			v, err := interp.Eval(step.input)
+			if err != nil {
+				t.Fatalf("%s: %q: unexpected error: %s", name, step.input, err)
+			}
+			if v.String() != step.expected {
+				t.Errorf("%s: %q: wrong value. want=%s, got=%s", name, step.input, step.expected, v)
+			}
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for name, interp := range engines() {
+		_, err := interp.Eval("let = 5;")
+
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Fatalf("%s: expected a *SyntaxError, got=%T (%v)", name, err, err)
+		}
+		if !strings.HasPrefix(err.Error(), "1:5: expected next token to be IDENT, got = instead\n") {
+			t.Errorf("%s: wrong syntax error. got=%q", name, err)
+		}
+
+		_, err = interp.Eval("let a = 1;\nlet b = a + true;")
+
+		var evalErr *Error
+		if !errors.As(err, &evalErr) {
+			t.Fatalf("%s: expected an *Error, got=%T (%v)", name, err, err)
+		}
+		if *evalErr != (Error{Message: "type mismatch: INTEGER + BOOLEAN", Line: 2, Column: 11}) {
+			t.Errorf("%s: wrong error. got=%+v", name, *evalErr)
+		}
+
+		// b never got a value, on either engine
+		if _, err := interp.Eval("b"); err == nil || !strings.Contains(err.Error(), "identifier not found: b") {
+			t.Errorf("%s: expected b to be undefined, got=%v", name, err)
+		}
+
+		// and the interpreter carries on after errors
+		if v, err := interp.Eval("1 + 1"); err != nil || v.String() != "2" {
+			t.Errorf("%s: wrong value after errors. got=%v, %v", name, v, err)
+		}
+	}
+}
+
+func TestSkippedLet(t *testing.T) {
+	for name, interp := range engines() {
+		if _, err := interp.Eval("let x = 1; if (false) { let y = 2; }; x"); err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if v, err := interp.Eval("x"); err != nil || v.String() != "1" {
+			t.Errorf("%s: wrong x. got=%v, %v", name, v, err)
+		}
+	}
+
+	// the evaluator never heard of y, the vm has it as null
+	if _, err := New().Eval("if (false) { let y = 2; }; y"); err == nil {
+		t.Errorf("eval: expected y to be undefined")
+	}
+	if v, err := New(WithVM()).Eval("if (false) { let y = 2; }; y"); err != nil || !v.IsNull() {
+		t.Errorf("vm: expected y to be null. got=%v, %v", v, err)
+	}
+}
+
+func TestWithStdout(t *testing.T) {
+	for name := range engines() {
+		var out bytes.Buffer
+		interp := New(WithStdout(&out))
+		if name == "vm" {
+			interp = New(WithStdout(&out), WithVM())
+		}
+
+		v, err := interp.Eval(`puts("hello", 1 + 2)`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if !v.IsNull() {
+			t.Errorf("%s: puts should return null, got=%s", name, v)
+		}
+		if out.String() != "hello\n3\n" {
+			t.Errorf("%s: wrong output. got=%q", name, out.String())
+		}
+	}
+}
+
+func TestWithoutBuiltins(t *testing.T) {
+	for name, interp := range engines(WithoutBuiltins("puts", "len", "nope")) {
+		_, err := interp.Eval(`len("abc")`)
+		if err == nil || err.Error() != "1:4: builtin len is disabled" {
+			t.Errorf("%s: wrong error. got=%v", name, err)
+		}
+
+		_, err = interp.Eval(`puts(1)`)
+		if err == nil || err.Error() != "1:5: builtin puts is disabled" {
+			t.Errorf("%s: wrong error. got=%v", name, err)
+		}
+
+		if v, err := interp.Eval(`first([1, 2])`); err != nil || v.String() != "1" {
+			t.Errorf("%s: other builtins should still work. got=%v, %v", name, v, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	forever := "let f = fn(n) { f(n + 1) }; f(0)"
+	slow := "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(40)"
+
+	doubling := `let f = fn(s) { f(s + s) }; f("ab")`
+	pushing := "let f = fn(a) { f(push(a, 1)) }; f([])"
+
+	for name, interp := range engines(WithMaxDepth(100), WithMaxLength(50), WithTimeout(50*time.Millisecond)) {
+		_, err := interp.Eval(forever)
+		if err == nil || !strings.HasSuffix(err.Error(), "maximum call depth exceeded (100)") {
+			t.Errorf("%s: wrong error for runaway recursion. got=%v", name, err)
+		}
+
+		for _, input := range []string{doubling, pushing} {
+			_, err = interp.Eval(input)
+			if err == nil || !strings.HasSuffix(err.Error(), "maximum length exceeded (50)") {
+				t.Errorf("%s: wrong error for %q. got=%v", name, input, err)
+			}
+		}
+
+		start := time.Now()
+		_, err = interp.Eval(slow)
+		if err == nil || !strings.HasSuffix(err.Error(), "time limit exceeded") {
+			t.Errorf("%s: wrong error for a slow program. got=%v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: the timeout took %s to kick in", name, elapsed)
+		}
+
+		// arrays made of the same array twice are small, but what puts prints
+		// of them doubles every time
+		_, err = interp.Eval("let f = fn(h, n) { if (n == 0) { h } else { f([h, h], n - 1) } }; puts(f([], 22))")
+		if err == nil || !strings.HasSuffix(err.Error(), "maximum length exceeded (50)") {
+			t.Errorf("%s: wrong error for printing nested arrays. got=%v", name, err)
+		}
+
+		// every Eval gets its own time, and the depth starts over
+		if v, err := interp.Eval("let g = fn(n) { if (n == 0) { 0 } else { 1 + g(n - 1) } }; g(90)"); err != nil || v.String() != "90" {
+			t.Errorf("%s: wrong value after hitting the limits. got=%v, %v", name, v, err)
+		}
+	}
+}
+
+// the vm's globals and constants are shared by every Eval, and there's only
+// so many of them
+func TestVMCapacity(t *testing.T) {
+	// identifiers can't have digits in them
+	name := func(i int) string {
+		return "x" + string(rune('a'+i/26/26/26)) + string(rune('a'+i/26/26%26)) + string(rune('a'+i/26%26)) + string(rune('a'+i%26))
+	}
+	program := func(from, to int, format string) string {
+		var b strings.Builder
+		for i := from; i < to; i++ {
+			fmt.Fprintf(&b, format, name(i))
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		programs []string // the last one fails, the others are fine
+		expected string
+	}{
+		{[]string{program(0, 66000, "let %s = 1;")}, "too many globals (the most there can be is 65536)"},
+		{[]string{program(0, 40000, "let %s = 1;"), program(40000, 66000, "let %s = 1;")}, "too many globals (the most there can be is 65536)"},
+		{[]string{program(0, 40000, "%q;"), program(40000, 66000, "%q;")}, "too many constants (the most there can be is 65536)"},
+	}
+
+	for i, tt := range tests {
+		interp := New(WithVM())
+		last := len(tt.programs) - 1
+
+		for _, p := range tt.programs[:last] {
+			if _, err := interp.Eval(p); err != nil {
+				t.Fatalf("tests[%d]: unexpected error: %s", i, err)
+			}
+		}
+
+		_, err := interp.Eval(tt.programs[last])
+		var evalErr *Error
+		if !errors.As(err, &evalErr) || !strings.HasSuffix(evalErr.Message, tt.expected) {
+			t.Errorf("tests[%d]: wrong error. want=%q, got=%v", i, tt.expected, err)
+		}
+
+		// what was there before is still there
+		if v, err := interp.Eval("1 + 1"); err != nil || v.String() != "2" {
+			t.Errorf("tests[%d]: wrong value after the error. got=%v, %v", i, v, err)
+		}
+	}
+}
+
+// without a length limit it's the deadline that stops puts
+func TestPrintingTimeout(t *testing.T) {
+	for name, interp := range engines(WithStdout(io.Discard), WithTimeout(100*time.Millisecond)) {
+		start := time.Now()
+		_, err := interp.Eval("let f = fn(h, n) { if (n == 0) { h } else { f([h, h], n - 1) } }; puts(f([], 40))")
+		if err == nil || !strings.HasSuffix(err.Error(), "time limit exceeded") {
+			t.Errorf("%s: wrong error. got=%v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: the timeout took %s to kick in", name, elapsed)
+		}
+	}
+}
+
+// assert_eq goes through arrays element by element, and prints them when
+// they aren't equal
+func TestAssertLimits(t *testing.T) {
+	nested := "let f = fn(h, n) { if (n == 0) { h } else { f([h, h], n - 1) } }; let x = f([1], 40); "
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{nested + "assert_eq(x, x)", ""},
+		{nested + "assert_eq(x, f([1], 40))", "time limit exceeded"},
+		{nested + "assert_eq(x, 1)", "maximum length exceeded (1048576)"},
+		{nested + "assert(false, x)", "maximum length exceeded (1048576)"},
+	}
+
+	for name, interp := range engines(WithMaxDepth(200), WithMaxLength(1<<20), WithTimeout(time.Second)) {
+		for _, tt := range tests {
+			start := time.Now()
+			_, err := interp.Eval(tt.input)
+			switch {
+			case tt.expected == "" && err != nil:
+				t.Errorf("%s: %q: unexpected error: %s", name, tt.input, err)
+			case tt.expected != "" && (err == nil || !strings.HasSuffix(err.Error(), tt.expected)):
+				t.Errorf("%s: %q: wrong error. want=%q, got=%v", name, tt.input, tt.expected, err)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("%s: %q took %s", name, tt.input, elapsed)
+			}
+		}
+	}
+}
+
+// what a program returns is printed under the same limits as what it puts
+func TestValueStringLimits(t *testing.T) {
+	nested := "let f = fn(h, n) { if (n == 0) { h } else { f([h, h], n - 1) } }; f([1], 40)"
+
+	for name, interp := range engines(WithMaxLength(20)) {
+		v, err := interp.Eval(nested)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if !strings.HasPrefix(v.String(), "[[[[[[[[[[") || !strings.HasSuffix(v.String(), "...") || len(v.String()) > 50 {
+			t.Errorf("%s: wrong string. got=%q", name, v.String())
+		}
+	}
+
+	for name, interp := range engines(WithTimeout(100 * time.Millisecond)) {
+		v, err := interp.Eval(nested)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		start := time.Now()
+		if s := v.String(); !strings.HasSuffix(s, "...") {
+			t.Errorf("%s: expected the string to be cut off", name)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: String took %s", name, elapsed)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedType string
+		expected     string
+	}{
+		{"1 + 2", "INTEGER", "3"},
+		{`"a" + "b"`, "STRING", "ab"},
+		{"1 < 2", "BOOLEAN", "true"},
+		{"[1, [2]]", "ARRAY", "[1, [2]]"},
+		{"if (false) { 1 }", "NULL", "null"},
+		{"let x = 1;", "NULL", "null"},
+	}
+
+	for name, interp := range engines() {
+		for _, tt := range tests {
+			v, err := interp.Eval(tt.input)
+			if err != nil {
+				t.Fatalf("%s: %q: unexpected error: %s", name, tt.input, err)
+			}
+			if v.Type() != tt.expectedType || v.String() != tt.expected {
+				t.Errorf("%s: %q: wrong value. want=%s %s, got=%s %s",
+					name, tt.input, tt.expectedType, tt.expected, v.Type(), v)
+			}
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package object
+
+import "fmt"
+
+/*
+Builtins are the functions that are always available without having to be
+defined first. they live here rather than in the evaluator because both
+engines need them: the evaluator looks them up by name, while the compiler
+refers to them by their index in this list - so new ones go at the end,
+or compiled code would end up calling the wrong function
+
+a builtin that has nothing to return returns nil, and each engine turns
+that into null
+*/
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *String:
+				return &Integer{Value: int64(len(arg.Value))}
+			default:
+				return newError("argument to `len` not supported, got %s",
+					args[0].Type())
+			}
+		},
+		},
+	},
+	{
+		"first",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `first` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+
+			return nil
+		},
+		},
+	},
+	{
+		"last",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `last` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+
+			return nil
+		},
+		},
+	},
+	// rest and push return new arrays - arrays in monkey are immutable
+	{
+		"rest",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `rest` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				newElements := make([]Object, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &Array{Elements: newElements}
+			}
+
+			return nil
+		},
+		},
+	},
+	{
+		"push",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+
+			newElements := make([]Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+
+			return &Array{Elements: newElements}
+		},
+		},
+	},
+	{
+		"puts",
+		&Builtin{Fn: func(args ...Object) Object {
+			for _, arg := range args {
+				fmt.Println(arg.Inspect())
+			}
+
+			return nil
+		},
+		},
+	},
+	// the asserts are for tests (see monkey test): a failed one is an error
+	// like any other, so it stops the program at the line it's on
+	{"assert", NewAssert(nil)},
+	{"assert_eq", NewAssertEq(nil)},
+}
+
+// GetBuiltinByName returns nil if there's no builtin called name
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// BuiltinName is GetBuiltinByName the other way around, b.Name for a
+// builtin that isn't one of Builtins (an embedder's, say)
+func BuiltinName(b *Builtin) string {
+	for _, def := range Builtins {
+		if def.Builtin == b {
+			return def.Name
+		}
+	}
+	return b.Name
+}
+
+/*
+NewAssert and NewAssertEq are the assert builtins with what they compare
+and print counted against limits, the way Limits.Inspect counts what puts
+prints - an embedder with limits defines its own with these. the ones in
+Builtins have nil limits and nothing stops them
+*/
+func NewAssert(limits *Limits) *Builtin {
+	return &Builtin{Fn: func(args ...Object) Object {
+		if len(args) != 1 && len(args) != 2 {
+			return newError("wrong number of arguments. got=%d, want=1 or 2",
+				len(args))
+		}
+
+		if truthy(args[0]) {
+			return nil
+		}
+		if len(args) == 1 {
+			return newError("assertion failed")
+		}
+		if msg, ok := args[1].(*String); ok {
+			return newError("assertion failed: %s", msg.Value)
+		}
+		msg, err := inspect(args[1], limits)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return newError("assertion failed: %s", msg)
+	}}
+}
+
+func NewAssertEq(limits *Limits) *Builtin {
+	return &Builtin{Fn: func(args ...Object) Object {
+		if len(args) != 2 {
+			return newError("wrong number of arguments. got=%d, want=2",
+				len(args))
+		}
+
+		got, want := args[0], args[1]
+		var step func() error
+		if limits != nil {
+			step = limits.Step
+		}
+		equal, err := equal(got, want, step)
+		if err != nil {
+			return newError("%s", err)
+		}
+		if equal {
+			return nil
+		}
+
+		gotText, err := inspect(got, limits)
+		if err != nil {
+			return newError("%s", err)
+		}
+		wantText, err := inspect(want, limits)
+		if err != nil {
+			return newError("%s", err)
+		}
+		if got.Type() != want.Type() {
+			// "1" and 1 look the same otherwise
+			return newError("assertion failed: got %s (%s), want %s (%s)",
+				gotText, got.Type(), wantText, want.Type())
+		}
+		return newError("assertion failed: got %s, want %s", gotText, wantText)
+	}}
+}
+
+// obj.Inspect(), or limits.Inspect when there are limits
+func inspect(obj Object, limits *Limits) (string, error) {
+	if limits == nil {
+		return obj.Inspect(), nil
+	}
+	return limits.Inspect(obj)
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// the same as both engines' isTruthy: only false and null are false
+func truthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+/*
+Equal is what assert_eq compares with. it's == for integers, strings and
+booleans, and goes through arrays and hashes element by element, so two
+arrays built separately are equal when what's in them is. functions are
+only equal to themselves
+*/
+func Equal(a, b Object) bool {
+	equal, _ := equal(a, b, nil)
+	return equal
+}
+
+/*
+equal calls step for every pair of elements it compares, and stops with
+its error. like with inspector, [a, a] with a = [b, b] and so on is a lot
+more to go through than it takes up - but an array is always equal to
+itself, however much is in it
+*/
+func equal(a, b Object, step func() error) (bool, error) {
+	if step != nil {
+		if err := step(); err != nil {
+			return false, err
+		}
+	}
+	if a.Type() != b.Type() {
+		return false, nil
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value, nil
+	case *String:
+		return a.Value == b.(*String).Value, nil
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value, nil
+	case *Null:
+		return true, nil
+	case *Array:
+		other := b.(*Array)
+		if a == other {
+			return true, nil
+		}
+		if len(a.Elements) != len(other.Elements) {
+			return false, nil
+		}
+		for i := range a.Elements {
+			if ok, err := equal(a.Elements[i], other.Elements[i], step); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case *Hash:
+		other := b.(*Hash)
+		if a == other {
+			return true, nil
+		}
+		if len(a.Pairs) != len(other.Pairs) {
+			return false, nil
+		}
+		for key, pair := range a.Pairs {
+			otherPair, ok := other.Pairs[key]
+			if !ok {
+				return false, nil
+			}
+			if ok, err := equal(pair.Value, otherPair.Value, step); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	default:
+		return a == b, nil
+	}
+}
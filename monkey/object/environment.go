@@ -0,0 +1,99 @@
+package object
+
+import (
+	"io"
+	"monkey/profile"
+	"sort"
+)
+
+/*
+the environment is what keeps track of values bound with let (and function
+parameters) - at its core it's just a map of names to objects
+
+every function call gets a new enclosed environment whose outer pointer
+refers to the environment the function was defined in, so lookups that
+miss in the inner scope fall through to the outer one
+*/
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+
+	// shared with every environment enclosed by this one, see SetLimits,
+	// SetTrace and SetProfile
+	limits  *Limits
+	trace   *Trace
+	profile *profile.Profile
+}
+
+func NewEnvironment() *Environment {
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: nil}
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	env.limits = outer.limits
+	env.trace = outer.trace
+	env.profile = outer.profile
+	return env
+}
+
+// SetLimits has the evaluator check l while evaluating in e, or in any
+// environment enclosed by it later - which includes the ones of calls to
+// functions defined in e
+func (e *Environment) SetLimits(l *Limits) { e.limits = l }
+
+func (e *Environment) Limits() *Limits { return e.limits }
+
+// Trace is where the evaluator writes a line for every node it evaluates,
+// and how deep it is in the tree. like Limits, it belongs to one program
+// at a time
+type Trace struct {
+	Out   io.Writer
+	Depth int
+}
+
+// SetTrace has the evaluator trace what it evaluates in e (and the
+// environments enclosed by it) to t, nil turns it off
+func (e *Environment) SetTrace(t *Trace) { e.trace = t }
+
+func (e *Environment) Trace() *Trace { return e.trace }
+
+// SetProfile has the evaluator tell p about every call it makes in e (and
+// the environments enclosed by it), nil turns it off
+func (e *Environment) SetProfile(p *profile.Profile) { e.profile = p }
+
+func (e *Environment) Profile() *profile.Profile { return e.profile }
+
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+// Names returns every name visible from this environment, including the
+// ones bound in outer environments, sorted and without duplicates
+func (e *Environment) Names() []string {
+	seen := make(map[string]bool)
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
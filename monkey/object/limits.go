@@ -0,0 +1,96 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+Limits are for running programs that can't be trusted to finish: both
+engines count calls and steps against them and stop the program with an
+error once it goes over. a step is one node for the evaluator and one
+instruction for the vm, so the two only agree on the limits themselves,
+not on how many steps a program takes
+
+the zero value doesn't limit anything. Limits keep count while a program
+runs, so they belong to one program at a time
+*/
+type Limits struct {
+	MaxDepth  int       // how deep calls may nest, 0 for no limit
+	MaxLength int       // how long a string or array may get, 0 for no limit
+	Deadline  time.Time // when to give up, the zero time for never
+
+	depth int
+	steps int
+}
+
+var ErrTimeLimit = errors.New("time limit exceeded")
+
+// the clock is only looked at every deadlineEvery steps, reading it is
+// slow compared to a step
+const deadlineEvery = 1024
+
+// Reset starts the count over, for the next program
+func (l *Limits) Reset() {
+	l.depth = 0
+	l.steps = 0
+}
+
+// Enter is called when a function gets called, and Leave when it returns
+func (l *Limits) Enter() error {
+	l.depth++
+	if l.MaxDepth > 0 && l.depth > l.MaxDepth {
+		return fmt.Errorf("maximum call depth exceeded (%d)", l.MaxDepth)
+	}
+	return nil
+}
+
+func (l *Limits) Leave() {
+	l.depth--
+}
+
+/*
+Length is called with what + and the builtins return, which is how a
+program makes strings and arrays bigger than the ones in its source. a
+string that doubles on every call only needs a few dozen calls to run
+out of memory, long before the deadline or the depth get to it
+*/
+func (l *Limits) Length(obj Object) error {
+	if l.MaxLength <= 0 {
+		return nil
+	}
+
+	n := 0
+	switch obj := obj.(type) {
+	case *String:
+		n = len(obj.Value)
+	case *Array:
+		n = len(obj.Elements)
+	}
+	if n > l.MaxLength {
+		return fmt.Errorf("maximum length exceeded (%d)", l.MaxLength)
+	}
+	return nil
+}
+
+/*
+Inspect is obj.Inspect() for what a program prints: the text is a string
+like any other, so it can't be longer than MaxLength, and printing checks
+the deadline as it goes. arrays that share elements print a lot more than
+they take up, so Length never sees them coming. when it gives up, the text
+is as far as it got
+*/
+func (l *Limits) Inspect(obj Object) (string, error) {
+	in := &inspector{max: l.MaxLength, step: l.Step}
+	in.write(obj)
+	return in.out.String(), in.err
+}
+
+func (l *Limits) Step() error {
+	l.steps++
+	if l.steps%deadlineEvery == 0 && !l.Deadline.IsZero() && time.Now().After(l.Deadline) {
+		return ErrTimeLimit
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+// the values our evaluator produces when it walks the AST (and the vm
+// produces when it runs bytecode)
+
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"monkey/ast"
+	"monkey/code"
+	"strings"
+)
+
+type ObjectType string
+
+/*
+every value in monkey is wrapped in a struct that satisfies the Object
+interface - this lets the evaluator pass around integers, booleans,
+functions etc. without knowing up front which kind it's dealing with
+*/
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	STRING_OBJ       = "STRING"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	BUILTIN_OBJ      = "BUILTIN"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+)
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+// Null represents the absence of a value (e.g. an if without an else whose
+// condition was false)
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+/*
+there is only ever one true, one false and one null, which both engines
+use, so they can compare booleans (and check for null) by pointer. values
+a go program makes with the embedding api (see monkey.ToValue) get to
+either engine, so they have to be the same ones everywhere
+*/
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+// ReturnValue wraps the value of a return statement so the evaluator knows
+// to stop evaluating the rest of the enclosing block
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// Error is produced for things like type mismatches and unknown operators
+// and, like ReturnValue, stops evaluation wherever it shows up
+type Error struct {
+	Message string
+	Line    int // position of the expression that failed, 0 if unknown
+	Column  int
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+// functions carry their own environment with them, which is what makes
+// closures work
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+
+	Name string // of the let it was defined in, for profiles
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+/*
+CompiledFunction is what the compiler turns a function literal into: the
+function's own instructions, plus what the vm needs to know to make room
+for it on the stack. they end up in the constant pool like any other
+literal
+*/
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Positions     code.PositionTable
+	NumLocals     int
+	NumParameters int
+
+	// only for profiles: the let it was defined in and the line its body
+	// starts on
+	Name string
+	Line int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+/*
+a Closure is what a CompiledFunction becomes when the vm runs into it:
+the function plus the values of the free variables it uses - names from
+an enclosing function, copied out of that function's frame while it's
+still there. every function the vm calls is a closure, even one that
+has no free variables
+*/
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// builtin functions are plain go functions that take and return objects
+type BuiltinFunction func(args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+
+	// what a profile calls one that stands in for a builtin, see
+	// BuiltinName. the ones in Builtins go by their names there
+	Name string
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+type Array struct {
+	Elements []Object
+}
+
+func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
+func (ao *Array) Inspect() string {
+	in := &inspector{}
+	in.write(ao)
+	return in.out.String()
+}
+
+/*
+hash keys can't just be the objects themselves: two *object.String with
+the same Value are different pointers, so "name" would never find "name".
+instead every hashable object knows how to turn itself into a HashKey that
+compares equal for equal values
+*/
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+
+	if b.Value {
+		value = 1
+	} else {
+		value = 0
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// the original key object is kept next to the value so Inspect() can print
+// it back out
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	in := &inspector{}
+	in.write(h)
+	return in.out.String()
+}
+
+/*
+inspector writes out arrays and hashes, element by element. the same
+array can be in another one any number of times - [a, a] with a = [b, b]
+and so on - so what a program built with a few dozen small arrays can
+print as gigabytes. Limits.Inspect uses max and step to give up on those
+early, plain Inspect leaves them 0 and nil and prints it all
+*/
+type inspector struct {
+	out  strings.Builder
+	max  int          // the most it writes, 0 for no limit
+	step func() error // called for every element, nil for nothing
+	err  error        // why it gave up
+}
+
+func (in *inspector) write(obj Object) {
+	if in.err != nil {
+		return
+	}
+	if in.step != nil {
+		if in.err = in.step(); in.err != nil {
+			return
+		}
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		in.out.WriteString("[")
+		for i, e := range obj.Elements {
+			if i > 0 {
+				in.out.WriteString(", ")
+			}
+			if in.write(e); in.err != nil {
+				return
+			}
+		}
+		in.out.WriteString("]")
+	case *Hash:
+		in.out.WriteString("{")
+		i := 0
+		for _, pair := range obj.Pairs {
+			if i > 0 {
+				in.out.WriteString(", ")
+			}
+			in.write(pair.Key)
+			in.out.WriteString(": ")
+			if in.write(pair.Value); in.err != nil {
+				return
+			}
+			i++
+		}
+		in.out.WriteString("}")
+	default:
+		in.out.WriteString(obj.Inspect())
+	}
+
+	if in.err == nil && in.max > 0 && in.out.Len() > in.max {
+		in.err = fmt.Errorf("maximum length exceeded (%d)", in.max)
+	}
+}
@@ -0,0 +1,199 @@
+package object
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeyTypesDontCollide(t *testing.T) {
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+
+	if one.HashKey() == yes.HashKey() {
+		t.Errorf("1 and true have the same hash key")
+	}
+}
+
+func TestEnvironmentNames(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("b", &Integer{Value: 1})
+	outer.Set("a", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("c", &Integer{Value: 3})
+	inner.Set("a", &Integer{Value: 4})
+
+	names := inner.Names()
+	expected := []string{"a", "b", "c"}
+
+	if len(names) != len(expected) {
+		t.Fatalf("wrong names. expected=%v, got=%v", expected, names)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Fatalf("wrong names. expected=%v, got=%v", expected, names)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	l := &Limits{MaxDepth: 2}
+
+	if err := l.Enter(); err != nil {
+		t.Fatalf("first call: unexpected error: %s", err)
+	}
+	if err := l.Enter(); err != nil {
+		t.Fatalf("second call: unexpected error: %s", err)
+	}
+	if err := l.Enter(); err == nil || err.Error() != "maximum call depth exceeded (2)" {
+		t.Errorf("third call: wrong error. got=%v", err)
+	}
+	l.Leave()
+	l.Leave()
+	if err := l.Enter(); err != nil {
+		t.Errorf("after returning: unexpected error: %s", err)
+	}
+
+	l = &Limits{Deadline: time.Now().Add(-time.Second)}
+	var err error
+	for i := 0; i < deadlineEvery && err == nil; i++ {
+		err = l.Step()
+	}
+	if err != ErrTimeLimit {
+		t.Errorf("expected the deadline to be noticed within %d steps, got=%v", deadlineEvery, err)
+	}
+
+	// no limits at all
+	l = &Limits{}
+	for i := 0; i < 10*deadlineEvery; i++ {
+		if err := l.Step(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	one := &Integer{Value: 1}
+	fn := &Builtin{}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{one, &Integer{Value: 1}, true},
+		{one, &Integer{Value: 2}, false},
+		{one, &String{Value: "1"}, false},
+		{&String{Value: "a"}, &String{Value: "a"}, true},
+		{&Null{}, &Null{}, true},
+		{&Array{Elements: []Object{one}}, &Array{Elements: []Object{&Integer{Value: 1}}}, true},
+		{&Array{Elements: []Object{one}}, &Array{}, false},
+		{
+			&Hash{Pairs: map[HashKey]HashPair{one.HashKey(): {Key: one, Value: one}}},
+			&Hash{Pairs: map[HashKey]HashPair{one.HashKey(): {Key: one, Value: &Integer{Value: 1}}}},
+			true,
+		},
+		{
+			&Hash{Pairs: map[HashKey]HashPair{one.HashKey(): {Key: one, Value: one}}},
+			&Hash{Pairs: map[HashKey]HashPair{one.HashKey(): {Key: one, Value: &Boolean{Value: true}}}},
+			false,
+		},
+		{fn, fn, true},
+		{fn, &Builtin{}, false},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d]: Equal(%s, %s) - expected %t, got %t", i, tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+	}
+
+	// 2^60 elements to go through, if an array weren't equal to itself
+	nested := Object(&Array{})
+	for i := 0; i < 60; i++ {
+		nested = &Array{Elements: []Object{nested, nested}}
+	}
+	if !Equal(nested, nested) {
+		t.Errorf("an array isn't equal to itself")
+	}
+}
+
+func TestLimitsLength(t *testing.T) {
+	l := &Limits{MaxLength: 3}
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{&String{Value: "abc"}, ""},
+		{&String{Value: "abcd"}, "maximum length exceeded (3)"},
+		{&Array{Elements: []Object{NULL, NULL, NULL, NULL}}, "maximum length exceeded (3)"},
+		{&Integer{Value: 12345}, ""},
+	}
+
+	for _, tt := range tests {
+		err := l.Length(tt.obj)
+		if tt.expected == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.obj.Inspect(), err)
+		}
+		if tt.expected != "" && (err == nil || err.Error() != tt.expected) {
+			t.Errorf("%s: wrong error. expected=%q, got=%v", tt.obj.Inspect(), tt.expected, err)
+		}
+	}
+
+	// no limit
+	if err := (&Limits{}).Length(&String{Value: "abcd"}); err != nil {
+		t.Errorf("unexpected error without a limit: %s", err)
+	}
+}
+
+func TestLimitsInspect(t *testing.T) {
+	one := &Integer{Value: 1}
+	hash := &Hash{Pairs: map[HashKey]HashPair{one.HashKey(): {Key: one, Value: &String{Value: "a"}}}}
+
+	// 2^30 ones, in 30 arrays
+	var nested Object = one
+	for i := 0; i < 30; i++ {
+		nested = &Array{Elements: []Object{nested, nested}}
+	}
+
+	tests := []struct {
+		limits   *Limits
+		obj      Object
+		expected string // the text, or the error
+	}{
+		{&Limits{MaxLength: 9}, &Array{Elements: []Object{one, hash}}, "maximum length exceeded (9)"},
+		{&Limits{MaxLength: 11}, &Array{Elements: []Object{one, hash}}, "[1, {1: a}]"},
+		{&Limits{MaxLength: 1 << 16}, nested, "maximum length exceeded (65536)"},
+		{&Limits{Deadline: time.Now().Add(-time.Second)}, nested, "time limit exceeded"},
+		{&Limits{}, &Array{Elements: []Object{one, one}}, "[1, 1]"},
+	}
+
+	for i, tt := range tests {
+		text, err := tt.limits.Inspect(tt.obj)
+		if err != nil {
+			text = err.Error()
+		}
+		if text != tt.expected {
+			t.Errorf("tests[%d]: want=%q, got=%q", i, tt.expected, text)
+		}
+	}
+}
@@ -0,0 +1,506 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"monkey/ast"
+	"monkey/lexer"
+)
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"let x = 5;", "x", 5},
+		{"let y = true;", "y", true},
+		{"let foobar = y;", "foobar", "y"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name.Value != tt.expectedIdentifier {
+			t.Fatalf("stmt.Name.Value not %q. got=%q", tt.expectedIdentifier, stmt.Name.Value)
+		}
+		if !testLiteralExpression(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `
+// add two numbers
+let add = fn(a, b) { a + b }; // no checks
+add(1, 2)
+`
+	program := parseProgram(t, input)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	if len(program.Comments) != 2 {
+		t.Fatalf("program.Comments does not contain 2 comments. got=%d", len(program.Comments))
+	}
+	if program.Comments[0].Literal != "// add two numbers" || program.Comments[0].Line != 2 {
+		t.Errorf("wrong first comment. got=%q at line %d", program.Comments[0].Literal, program.Comments[0].Line)
+	}
+	if program.Comments[1].Literal != "// no checks" || program.Comments[1].Line != 3 {
+		t.Errorf("wrong second comment. got=%q at line %d", program.Comments[1].Literal, program.Comments[1].Line)
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return true;", true},
+		{"return foobar;", "foobar"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		stmt, ok := program.Statements[0].(*ast.ReturnStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
+		}
+		if !testLiteralExpression(t, stmt.ReturnValue, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestParsingErrors(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedError  string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"let = 5;", "expected next token to be IDENT, got = instead", 1, 5},
+		{"let x 5;", "expected next token to be =, got INT instead", 1, 7},
+		{"}", "no prefix parse function for } found", 1, 1},
+		{"if (x { x }", "expected next token to be ), got { instead", 1, 7},
+		{"let x = 1;\nlet y = @;", "illegal character \"@\"", 2, 9},
+		{`puts("abc)`, "unterminated string", 1, 6},
+		{"99999999999999999999", `could not parse "99999999999999999999" as integer`, 1, 1},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.ParseErrors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0].Message != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0].Message)
+		}
+		if errors[0].Line != tt.expectedLine || errors[0].Column != tt.expectedColumn {
+			t.Errorf("wrong error position for %q. expected=%d:%d, got=%d:%d",
+				tt.input, tt.expectedLine, tt.expectedColumn, errors[0].Line, errors[0].Column)
+		}
+	}
+}
+
+func TestOperatorPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-a * b", "((-a) * b)"},
+		{"!-a", "(!(-a))"},
+		{"a + b + c", "((a + b) + c)"},
+		{"a + b * c + d / e - f", "(((a + (b * c)) + (d / e)) - f)"},
+		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
+		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
+		{"3 > 5 == false", "((3 > 5) == false)"},
+		{"1 + (2 + 3) + 4", "((1 + (2 + 3)) + 4)"},
+		{"-(5 + 5)", "(-(5 + 5))"},
+		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
+		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	program := parseProgram(t, `if (x < y) { x } else { y }`)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Fatalf("consequence is not 1 statement. got=%d", len(exp.Consequence.Statements))
+	}
+	consequence := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if exp.Alternative == nil {
+		t.Fatalf("exp.Alternative was nil")
+	}
+	alternative := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	testIdentifier(t, alternative.Expression, "y")
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{"fn() {};", []string{}},
+		{"fn(x) {};", []string{"x"}},
+		{"fn(x, y, z) { x + y; };", []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestFunctionLiteralWithName(t *testing.T) {
+	program := parseProgram(t, `let myFunction = fn() { };`)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+
+	if function.Name != "myFunction" {
+		t.Fatalf("function literal name wrong. want 'myFunction', got=%q", function.Name)
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	program := parseProgram(t, "add(1, 2 * 3, 4 + 5);")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	program := parseProgram(t, `"hello world";`)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	program := parseProgram(t, "[1, 2 * 2, 3 + 3]")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	program := parseProgram(t, "myArray[1 + 1]")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	testInfixExpression(t, indexExp.Index, 1, "+", 1)
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, `{}`},
+		{`{"one": 1, "two": 2, "three": 3}`, `{one:1, two:2, three:3}`},
+		{`{"one": 0 + 1, true: 10 - 8}`, `{one:(0 + 1), true:(10 - 8)}`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		hash, ok := stmt.Expression.(*ast.HashLiteral)
+		if !ok {
+			t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+		}
+
+		if len(hash.Pairs) != len(hash.Keys) {
+			t.Fatalf("hash.Pairs and hash.Keys disagree. pairs=%d, keys=%d",
+				len(hash.Pairs), len(hash.Keys))
+		}
+
+		if hash.String() != tt.expected {
+			t.Errorf("hash.String() wrong. expected=%q, got=%q", tt.expected, hash.String())
+		}
+	}
+}
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	return program
+}
+
+func checkParserErrors(t *testing.T, p *Parser) {
+	t.Helper()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		return
+	}
+
+	t.Errorf("parser has %d errors", len(errors))
+	for _, msg := range errors {
+		t.Errorf("parser error: %q", msg)
+	}
+	t.FailNow()
+}
+
+func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
+	integ, ok := il.(*ast.IntegerLiteral)
+	if !ok {
+		t.Errorf("il not *ast.IntegerLiteral. got=%T", il)
+		return false
+	}
+
+	if integ.Value != value {
+		t.Errorf("integ.Value not %d. got=%d", value, integ.Value)
+		return false
+	}
+
+	if integ.TokenLiteral() != fmt.Sprintf("%d", value) {
+		t.Errorf("integ.TokenLiteral not %d. got=%s", value, integ.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		t.Errorf("exp not *ast.Identifier. got=%T", exp)
+		return false
+	}
+
+	if ident.Value != value {
+		t.Errorf("ident.Value not %s. got=%s", value, ident.Value)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
+	bo, ok := exp.(*ast.Boolean)
+	if !ok {
+		t.Errorf("exp not *ast.Boolean. got=%T", exp)
+		return false
+	}
+
+	if bo.Value != value {
+		t.Errorf("bo.Value not %t. got=%t", value, bo.Value)
+		return false
+	}
+
+	return true
+}
+
+func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{}) bool {
+	switch v := expected.(type) {
+	case int:
+		return testIntegerLiteral(t, exp, int64(v))
+	case int64:
+		return testIntegerLiteral(t, exp, v)
+	case string:
+		return testIdentifier(t, exp, v)
+	case bool:
+		return testBooleanLiteral(t, exp, v)
+	}
+	t.Errorf("type of exp not handled. got=%T", exp)
+	return false
+}
+
+func testInfixExpression(t *testing.T, exp ast.Expression, left interface{},
+	operator string, right interface{}) bool {
+
+	opExp, ok := exp.(*ast.InfixExpression)
+	if !ok {
+		t.Errorf("exp is not ast.InfixExpression. got=%T(%s)", exp, exp)
+		return false
+	}
+
+	if !testLiteralExpression(t, opExp.Left, left) {
+		return false
+	}
+
+	if opExp.Operator != operator {
+		t.Errorf("exp.Operator is not '%s'. got=%q", operator, opExp.Operator)
+		return false
+	}
+
+	return testLiteralExpression(t, opExp.Right, right)
+}
+
+// input that nests deeper than maxNesting gets one error, at the point it
+// got too deep, and the parser skips the rest instead of recursing into it
+func TestNestingLimit(t *testing.T) {
+	tests := []struct {
+		input  string
+		column int
+	}{
+		{strings.Repeat("(", maxNesting+10), maxNesting + 1},
+		{strings.Repeat("-", maxNesting+10) + "1", maxNesting + 1},
+		{"1" + strings.Repeat(" + 1", maxNesting+10), 4*maxNesting - 3}, // the right of the last + that fits
+		{"f" + strings.Repeat("()", maxNesting+10), 2 * maxNesting},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.ParseErrors()
+		if len(errors) != 1 {
+			t.Errorf("%.10q...: expected 1 error, got %d: %v", tt.input, len(errors), errors[:min(len(errors), 3)])
+			continue
+		}
+		expected := fmt.Sprintf("expression nested too deeply (more than %d levels)", maxNesting)
+		if errors[0].Message != expected || errors[0].Column != tt.column {
+			t.Errorf("%.10q...: wrong error. expected %q at column %d, got %q at column %d",
+				tt.input, expected, tt.column, errors[0].Message, errors[0].Column)
+		}
+	}
+
+	// just inside the limit is fine
+	p := New(lexer.New(strings.Repeat("-", maxNesting-1) + "1"))
+	p.ParseProgram()
+	if len(p.ParseErrors()) != 0 {
+		t.Errorf("unexpected errors: %v", p.ParseErrors())
+	}
+}
+
+/*
+FuzzParser checks that the parser never panics, whatever it's given, and
+that every error it reports comes with a position to show it at
+
+	go test ./parser -fuzz FuzzParser
+*/
+func FuzzParser(f *testing.F) {
+	for _, seed := range []string{
+		"let x = 5; return x;",
+		"let add = fn(a, b) { a + b }; add(1, 2 * 3)[0];",
+		`if (x < y) { x } else { y }; {"a": [1, 2], true: fn() {}}`,
+		"let = ; fn(, { [ (",
+		"-!-!a + b * c / d - e(f, g)[h]",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		if program := p.ParseProgram(); program == nil {
+			t.Fatalf("no program for %q", input)
+		}
+
+		for _, err := range p.ParseErrors() {
+			if err.Line < 1 || err.Column < 1 {
+				t.Fatalf("error without a position: %+v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+)
+
+/*
+WritePprof writes the profile as go tool pprof reads them: a gzipped
+protocol buffer message (profile.proto in github.com/google/pprof). each
+sample is one distinct stack of calls, with two values - how many calls
+returned with exactly that stack and the time they spent themselves - so
+pprof can work the rest out:
+
+	go tool pprof -top -sample_index=time prof.pb.gz
+
+every function gets one location, at the line its body starts on; there
+are no addresses or mappings since nothing here is machine code
+*/
+func (p *Profile) WritePprof(w io.Writer) error {
+	p.Stop()
+
+	table := newStringTable()
+	var b protobuf
+
+	// sample_type = 1, calls then time
+	for _, st := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		b.message(1, func(m *protobuf) {
+			m.int(1, table.index(st[0]))
+			m.int(2, table.index(st[1]))
+		})
+	}
+
+	// sample = 2, in a fixed order so the same profile gives the same bytes
+	samples := make([]*sample, 0, len(p.samples))
+	for _, s := range p.samples {
+		samples = append(samples, s)
+	}
+	sort.Slice(samples, func(i, j int) bool { return less(samples[i].stack, samples[j].stack) })
+
+	for _, s := range samples {
+		b.message(2, func(m *protobuf) {
+			ids := make([]uint64, len(s.stack))
+			for i, fn := range s.stack {
+				ids[i] = uint64(fn.id)
+			}
+			m.packed(1, ids)
+			m.packed(2, []uint64{uint64(s.calls), uint64(s.flat)})
+		})
+	}
+
+	// location = 4 and function = 5, with the same ids
+	for _, fn := range p.Functions {
+		b.message(4, func(m *protobuf) {
+			m.int(1, int64(fn.id))
+			m.message(4, func(line *protobuf) {
+				line.int(1, int64(fn.id))
+				line.int(2, int64(fn.Line))
+			})
+		})
+	}
+	for _, fn := range p.Functions {
+		b.message(5, func(m *protobuf) {
+			m.int(1, int64(fn.id))
+			m.int(2, table.index(fn.describe()))
+			m.int(3, table.index(fn.Name))
+			m.int(4, table.index(p.File))
+			m.int(5, int64(fn.Line))
+		})
+	}
+
+	// time_nanos = 9 is left out, duration_nanos = 10
+	b.int(10, int64(p.Duration))
+
+	// period_type = 11 and period = 12: every call is counted, not sampled
+	b.message(11, func(m *protobuf) {
+		m.int(1, table.index("calls"))
+		m.int(2, table.index("count"))
+	})
+	b.int(12, 1)
+
+	// string_table = 6 goes last, once everything's in it
+	for _, s := range table.strings {
+		b.string(6, s)
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.buf); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func less(a, b []*Function) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].id != b[i].id {
+			return a[i].id < b[i].id
+		}
+	}
+	return len(a) < len(b)
+}
+
+// the strings in a profile are indexes into its string table, which has
+// to start with ""
+type stringTable struct {
+	strings []string
+	indexes map[string]int64
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, indexes: map[string]int64{"": 0}}
+}
+
+func (t *stringTable) index(s string) int64 {
+	if i, ok := t.indexes[s]; ok {
+		return i
+	}
+	i := int64(len(t.strings))
+	t.strings = append(t.strings, s)
+	t.indexes[s] = i
+	return i
+}
+
+/*
+protobuf is just enough of the protocol buffer wire format for a
+profile: every field is a key (the field number and a wire type) followed
+by either a varint or, for strings, packed numbers and embedded messages,
+a varint length and that many bytes
+*/
+type protobuf struct {
+	buf []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.buf = append(b.buf, byte(x)|0x80)
+		x >>= 7
+	}
+	b.buf = append(b.buf, byte(x))
+}
+
+func (b *protobuf) key(field, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// zero is the default, which doesn't need to be written
+func (b *protobuf) int(field int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(uint64(x))
+}
+
+// a string in a repeated field is written even when it's empty, or the
+// string table would come out one short
+func (b *protobuf) string(field int, s string) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(s)))
+	b.buf = append(b.buf, s...)
+}
+
+func (b *protobuf) packed(field int, xs []uint64) {
+	var inner protobuf
+	for _, x := range xs {
+		inner.varint(x)
+	}
+	b.key(field, wireBytes)
+	b.varint(uint64(len(inner.buf)))
+	b.buf = append(b.buf, inner.buf...)
+}
+
+func (b *protobuf) message(field int, fill func(m *protobuf)) {
+	var inner protobuf
+	fill(&inner)
+	b.key(field, wireBytes)
+	b.varint(uint64(len(inner.buf)))
+	b.buf = append(b.buf, inner.buf...)
+}
@@ -0,0 +1,262 @@
+/*
+Package profile finds out where a monkey program spends its time. both
+engines tell a Profile about every call and return while it runs (see
+object.Environment.SetProfile and vm.SetProfile), the vm also how often
+it ran each opcode, and afterwards the profile prints a report:
+
+	profile: 8.103ms, 1974 calls
+
+	  calls     flat  flat%      cum    cum%  function
+	      1     22µs   0.3%  8.101ms  100.0%  main
+	   1973  8.052ms  99.4%  8.052ms   99.4%  fib (line 1)
+	      1     27µs   0.3%     27µs    0.3%  puts
+
+flat is the time spent in the function itself, cum includes what it
+called - and is only counted once for a function that calls itself, so
+the cum of a recursive function is the time from its outermost call to
+when that returns. main is the program outside of any function
+
+WritePprof writes the same in the format go tool pprof reads, for its
+graphs and flame graphs
+*/
+package profile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type Profile struct {
+	File string // the script, for the file names in WritePprof
+
+	Functions []*Function    // in the order they were first called, main first
+	Opcodes   map[string]int // how often each opcode ran (vm only)
+	Duration  time.Duration  // from New to Stop
+
+	byKey map[functionKey]*Function
+	stack []activation
+
+	// the time spent in each distinct stack of calls, for WritePprof
+	samples map[string]*sample
+
+	start   time.Time
+	stopped bool
+	now     func() time.Time // the clock, which the tests replace
+}
+
+// Function is a function the program called, with what it cost
+type Function struct {
+	Name string // the let it was bound to, fn if none, or the builtin's
+	Line int    // where its body starts, 0 for builtins and main
+
+	Calls int
+	Flat  time.Duration
+	Cum   time.Duration
+
+	id     int // for WritePprof, from 1
+	active int // calls in progress, so recursion doesn't count cum twice
+}
+
+type functionKey struct {
+	name string
+	line int
+}
+
+type activation struct {
+	fn      *Function
+	start   time.Time
+	callees time.Duration // time spent in the calls it made
+}
+
+type sample struct {
+	stack []*Function // innermost first, like pprof wants them
+	calls int64
+	flat  time.Duration
+}
+
+const mainName = "main"
+
+// New starts the clock. the program itself counts as the first call,
+// to main
+func New() *Profile {
+	p := &Profile{
+		Opcodes: map[string]int{},
+		byKey:   map[functionKey]*Function{},
+		samples: map[string]*sample{},
+		now:     time.Now,
+	}
+	p.start = p.now()
+	p.Enter(mainName, 0)
+	return p
+}
+
+// Enter is called when a function gets called. a function without a
+// name is called fn
+func (p *Profile) Enter(name string, line int) {
+	if p.stopped {
+		return
+	}
+	if name == "" {
+		name = "fn"
+	}
+
+	key := functionKey{name, line}
+	fn, ok := p.byKey[key]
+	if !ok {
+		fn = &Function{Name: name, Line: line, id: len(p.Functions) + 1}
+		p.byKey[key] = fn
+		p.Functions = append(p.Functions, fn)
+	}
+
+	fn.Calls++
+	fn.active++
+	p.stack = append(p.stack, activation{fn: fn, start: p.now()})
+}
+
+// Leave is called when the function that was entered last returns
+func (p *Profile) Leave() {
+	if p.stopped || len(p.stack) == 0 {
+		return
+	}
+	p.leave(p.now())
+}
+
+func (p *Profile) leave(now time.Time) {
+	top := p.stack[len(p.stack)-1]
+	elapsed := now.Sub(top.start)
+	flat := elapsed - top.callees
+
+	top.fn.Flat += flat
+	top.fn.active--
+	if top.fn.active == 0 {
+		top.fn.Cum += elapsed
+	}
+
+	p.record(flat)
+
+	p.stack = p.stack[:len(p.stack)-1]
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].callees += elapsed
+	}
+}
+
+func (p *Profile) record(flat time.Duration) {
+	ids := make([]string, len(p.stack))
+	for i := range p.stack {
+		ids[i] = fmt.Sprint(p.stack[len(p.stack)-1-i].fn.id)
+	}
+	key := strings.Join(ids, ",")
+
+	s, ok := p.samples[key]
+	if !ok {
+		s = &sample{}
+		for i := len(p.stack) - 1; i >= 0; i-- {
+			s.stack = append(s.stack, p.stack[i].fn)
+		}
+		p.samples[key] = s
+	}
+	s.calls++
+	s.flat += flat
+}
+
+// Op counts n runs of an opcode
+func (p *Profile) Op(name string, n int) {
+	p.Opcodes[name] += n
+}
+
+// Stop ends the profile. the calls still in progress - because the
+// program stopped with an error, say - end here too
+func (p *Profile) Stop() {
+	if p.stopped {
+		return
+	}
+
+	now := p.now()
+	for len(p.stack) > 0 {
+		p.leave(now)
+	}
+	p.Duration = now.Sub(p.start)
+	p.stopped = true
+}
+
+func (p *Profile) calls() int {
+	n := 0
+	for _, fn := range p.Functions {
+		if fn.Name != mainName || fn.Line != 0 {
+			n += fn.Calls
+		}
+	}
+	return n
+}
+
+// WriteText writes the report, the most expensive functions (by cum)
+// first, then the opcodes if there are any
+func (p *Profile) WriteText(w io.Writer) error {
+	p.Stop()
+
+	functions := append([]*Function{}, p.Functions...)
+	sort.SliceStable(functions, func(i, j int) bool {
+		if functions[i].Cum != functions[j].Cum {
+			return functions[i].Cum > functions[j].Cum
+		}
+		return functions[i].Flat > functions[j].Flat
+	})
+
+	fmt.Fprintf(w, "profile: %s, %d calls\n\n", round(p.Duration), p.calls())
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "calls\tflat\tflat%%\tcum\tcum%%\t  function\n")
+	for _, fn := range functions {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t  %s\n",
+			fn.Calls, round(fn.Flat), p.percent(fn.Flat), round(fn.Cum), p.percent(fn.Cum), fn.describe())
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(p.Opcodes) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(p.Opcodes))
+	for name := range p.Opcodes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if p.Opcodes[names[i]] != p.Opcodes[names[j]] {
+			return p.Opcodes[names[i]] > p.Opcodes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "count\t  opcode")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%d\t  %s\n", p.Opcodes[name], name)
+	}
+	return tw.Flush()
+}
+
+func (fn *Function) describe() string {
+	if fn.Line == 0 {
+		return fn.Name
+	}
+	return fmt.Sprintf("%s (line %d)", fn.Name, fn.Line)
+}
+
+func (p *Profile) percent(d time.Duration) string {
+	if p.Duration <= 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(d)/float64(p.Duration))
+}
+
+// to the microsecond, the rest is noise
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,148 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a clock that moves on by a millisecond every time it's read
+func fakeClock(p *Profile) {
+	t := time.Unix(0, 0)
+	p.now = func() time.Time {
+		t = t.Add(time.Millisecond)
+		return t
+	}
+	p.start = p.now()
+	p.stack[0].start = p.start
+}
+
+func TestCalls(t *testing.T) {
+	p := New()
+	fakeClock(p)
+
+	// main calls f, which calls itself and then g
+	p.Enter("f", 1)
+	p.Enter("f", 1)
+	p.Leave()
+	p.Enter("g", 5)
+	p.Leave()
+	p.Leave()
+	p.Stop()
+
+	tests := []struct {
+		name  string
+		calls int
+		flat  time.Duration
+		cum   time.Duration
+	}{
+		{"main", 1, 2 * time.Millisecond, 7 * time.Millisecond},
+		{"f", 2, 4 * time.Millisecond, 5 * time.Millisecond},
+		{"g", 1, 1 * time.Millisecond, 1 * time.Millisecond},
+	}
+
+	if len(p.Functions) != len(tests) {
+		t.Fatalf("wrong number of functions. expected=%d, got=%d", len(tests), len(p.Functions))
+	}
+	for i, tt := range tests {
+		fn := p.Functions[i]
+		if fn.Name != tt.name || fn.Calls != tt.calls || fn.Flat != tt.flat || fn.Cum != tt.cum {
+			t.Errorf("functions[%d]: expected %s %d calls flat=%s cum=%s, got %s %d calls flat=%s cum=%s",
+				i, tt.name, tt.calls, tt.flat, tt.cum, fn.Name, fn.Calls, fn.Flat, fn.Cum)
+		}
+	}
+
+	if p.Duration != 7*time.Millisecond {
+		t.Errorf("wrong duration. expected=7ms, got=%s", p.Duration)
+	}
+}
+
+func TestStopEndsOpenCalls(t *testing.T) {
+	p := New()
+	fakeClock(p)
+
+	p.Enter("", 3)
+	p.Stop()
+	p.Enter("late", 4) // after Stop, ignored
+
+	if len(p.Functions) != 2 || p.Functions[1].Name != "fn" {
+		t.Fatalf("expected main and fn, got %+v", p.Functions)
+	}
+	if p.Functions[1].Cum != time.Millisecond || p.Functions[0].Cum != 2*time.Millisecond {
+		t.Errorf("wrong cum. got main=%s fn=%s", p.Functions[0].Cum, p.Functions[1].Cum)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	p := New()
+	fakeClock(p)
+	p.Enter("fib", 1)
+	p.Leave()
+	p.Enter("puts", 0)
+	p.Leave()
+	p.Op("OpCall", 2)
+	p.Op("OpConstant", 5)
+
+	var out bytes.Buffer
+	if err := p.WriteText(&out); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+
+	expected := `profile: 5ms, 2 calls
+
+  calls  flat  flat%  cum    cum%  function
+      1   3ms  60.0%  5ms  100.0%  main
+      1   1ms  20.0%  1ms   20.0%  fib (line 1)
+      1   1ms  20.0%  1ms   20.0%  puts
+
+  count  opcode
+      5  OpConstant
+      2  OpCall
+`
+	if out.String() != expected {
+		t.Errorf("wrong report.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+
+	// the evaluator doesn't count opcodes, so there's no table for them
+	p = New()
+	out.Reset()
+	p.WriteText(&out)
+	if strings.Contains(out.String(), "opcode") {
+		t.Errorf("expected no opcodes, got %q", out.String())
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	p := New()
+	fakeClock(p)
+	p.Enter("fib", 1)
+	p.Leave()
+
+	var out bytes.Buffer
+	if err := p.WritePprof(&out); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("not gzipped: %s", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+
+	// the first field is the calls sample type: field 1, 4 bytes long,
+	// with its type and unit as strings 1 and 2
+	if !bytes.HasPrefix(data, []byte{1<<3 | wireBytes, 4, 1<<3 | wireVarint, 1, 2<<3 | wireVarint, 2}) {
+		t.Errorf("wrong start of profile. got=% x", data[:min(len(data), 16)])
+	}
+	for _, s := range []string{"calls", "nanoseconds", "fib (line 1)", "main"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("string table is missing %q", s)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package repl
+
+import (
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+/*
+newCompleter builds the tab completion for a REPL session. it looks at the
+environment every time tab is pressed, so names bound with let show up as
+soon as the line defining them has been evaluated
+*/
+func newCompleter(env *object.Environment) completeFunc {
+	return func(line []rune, pos int) ([]rune, int, []string) {
+		start := pos
+		for start > 0 && isIdentRune(line[start-1]) {
+			start--
+		}
+
+		prefix := string(line[start:pos])
+		if prefix == "" {
+			return line, pos, nil
+		}
+
+		candidates := completions(prefix, env)
+		if len(candidates) == 0 {
+			return line, pos, nil
+		}
+
+		insert := []rune(commonPrefix(candidates)[len(prefix):])
+
+		completed := append([]rune{}, line[:pos]...)
+		completed = append(completed, insert...)
+		completed = append(completed, line[pos:]...)
+
+		if len(candidates) == 1 {
+			return completed, pos + len(insert), nil
+		}
+
+		return completed, pos + len(insert), candidates
+	}
+}
+
+// keywords, builtins and bound names starting with prefix, sorted and
+// without duplicates (a let can shadow a builtin)
+func completions(prefix string, env *object.Environment) []string {
+	seen := make(map[string]bool)
+	candidates := []string{}
+
+	for _, names := range [][]string{token.Keywords(), evaluator.BuiltinNames(), env.Names()} {
+		for _, name := range names {
+			if strings.HasPrefix(name, prefix) && !seen[name] {
+				seen[name] = true
+				candidates = append(candidates, name)
+			}
+		}
+	}
+
+	sort.Strings(candidates)
+	return candidates
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// same set of characters the lexer accepts in identifiers
+func isIdentRune(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_'
+}
@@ -0,0 +1,57 @@
+package repl
+
+import (
+	"testing"
+
+	"monkey/object"
+)
+
+func TestCompleter(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("counter", &object.Integer{Value: 1})
+	env.Set("count", &object.Integer{Value: 2})
+	env.Set("lenient", &object.Integer{Value: 3})
+
+	complete := newCompleter(env)
+
+	tests := []struct {
+		line               string
+		pos                int
+		expectedLine       string
+		expectedPos        int
+		expectedCandidates []string
+	}{
+		{"ret", 3, "return", 6, nil},
+		{"pus", 3, "push", 4, nil},
+		{"pu", 2, "pu", 2, []string{"push", "puts"}},
+		{"co", 2, "count", 5, []string{"count", "counter"}},
+		{"le", 2, "le", 2, []string{"len", "lenient", "let"}},
+		{"f", 1, "f", 1, []string{"false", "first", "fn"}},
+		{"x + cou", 7, "x + count", 9, []string{"count", "counter"}},
+		{"fir([1])", 3, "first([1])", 5, nil},
+		{"zzz", 3, "zzz", 3, nil},
+		{"1 + ", 4, "1 + ", 4, nil},
+	}
+
+	for _, tt := range tests {
+		line, pos, candidates := complete([]rune(tt.line), tt.pos)
+
+		if string(line) != tt.expectedLine || pos != tt.expectedPos {
+			t.Errorf("complete(%q, %d) wrong. expected=%q@%d, got=%q@%d",
+				tt.line, tt.pos, tt.expectedLine, tt.expectedPos, string(line), pos)
+		}
+
+		if len(candidates) != len(tt.expectedCandidates) {
+			t.Errorf("complete(%q, %d) candidates wrong. expected=%v, got=%v",
+				tt.line, tt.pos, tt.expectedCandidates, candidates)
+			continue
+		}
+		for i := range candidates {
+			if candidates[i] != tt.expectedCandidates[i] {
+				t.Errorf("complete(%q, %d) candidates wrong. expected=%v, got=%v",
+					tt.line, tt.pos, tt.expectedCandidates, candidates)
+				break
+			}
+		}
+	}
+}
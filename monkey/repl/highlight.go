@@ -0,0 +1,86 @@
+package repl
+
+import (
+	"monkey/lexer"
+	"monkey/token"
+	"strings"
+)
+
+/*
+highlight colors a line of input as it's being typed. it goes by the
+lexer's tokens rather than patterns of its own, so it always agrees with
+what the parser is going to see - an unterminated string shows up red
+because the lexer turns it into an ILLEGAL token
+
+each token is painted from where it starts up to where the next one
+starts, which takes the whitespace in between along but saves working out
+how long each token was in the source (strings lose their quotes). the
+lexer keeps comments apart from the tokens, so they're put back in where
+they were - otherwise a comment would get the color of whatever came
+before it
+*/
+func (pr *printer) highlight(line string) string {
+	if !pr.color {
+		return line
+	}
+
+	tokens := withComments(line)
+	if len(tokens) == 1 {
+		return line // nothing but whitespace
+	}
+
+	var out strings.Builder
+	out.WriteString(line[:tokens[0].Column-1])
+
+	for i, tok := range tokens[:len(tokens)-1] {
+		start := tok.Column - 1
+		end := len(line)
+		if next := tokens[i+1]; next.Type != token.EOF {
+			end = next.Column - 1
+		}
+
+		text := line[start:end]
+		if color := tokenColor(tok.Type); color != "" {
+			// the trailing whitespace stays outside the color
+			trimmed := strings.TrimRight(text, " \t")
+			out.WriteString(pr.paint(color, trimmed) + text[len(trimmed):])
+		} else {
+			out.WriteString(text)
+		}
+	}
+
+	return out.String()
+}
+
+// withComments is lexer.Tokenize with the comments put back: a comment
+// goes to the end of the line, so it's whatever comes before the EOF
+func withComments(line string) []token.Token {
+	l := lexer.New(line)
+
+	var tokens []token.Token
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			return append(append(tokens, l.Comments()...), tok)
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// the same colors the printer uses for values of the same kind
+func tokenColor(t token.TokenType) string {
+	switch {
+	case t == token.INT:
+		return colorYellow
+	case t == token.STRING:
+		return colorGreen
+	case t == token.ILLEGAL:
+		return colorRed
+	case t == token.COMMENT:
+		return colorGray
+	case token.IsKeyword(t):
+		return colorMagenta
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,39 @@
+package repl
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"   ", "   "},
+		{"x + y", "x + y"},
+		{"let x = 5;", colorMagenta + "let" + colorReset + " x = " + colorYellow + "5" + colorReset + ";"},
+		{`  puts("hi")`, `  puts(` + colorGreen + `"hi"` + colorReset + `)`},
+		{`if (true) { 1 }`, colorMagenta + "if" + colorReset + " (" + colorMagenta + "true" + colorReset +
+			") { " + colorYellow + "1" + colorReset + " }"},
+		{`let s = "abc`, colorMagenta + "let" + colorReset + " s = " + colorRed + `"abc` + colorReset},
+		{"1 @ 2", colorYellow + "1" + colorReset + " " + colorRed + "@" + colorReset + " " + colorYellow + "2" + colorReset},
+		{"x // hi", "x " + colorGray + "// hi" + colorReset},
+		{"1 // one", colorYellow + "1" + colorReset + " " + colorGray + "// one" + colorReset},
+		{"let x = 5; // five", colorMagenta + "let" + colorReset + " x = " + colorYellow + "5" + colorReset + "; " +
+			colorGray + "// five" + colorReset},
+		{"// if true", colorGray + "// if true" + colorReset},
+		{`"a // b"`, colorGreen + `"a // b"` + colorReset},
+	}
+
+	pr := &printer{color: true, width: maxInlineWidth}
+
+	for _, tt := range tests {
+		if got := pr.highlight(tt.input); got != tt.expected {
+			t.Errorf("wrong highlighting for %q.\nexpected=%q\ngot=     %q", tt.input, tt.expected, got)
+		}
+	}
+
+	plain := &printer{width: maxInlineWidth}
+	if got := plain.highlight("let x = 5;"); got != "let x = 5;" {
+		t.Errorf("highlight without color changed the line. got=%q", got)
+	}
+}
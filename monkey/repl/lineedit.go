@@ -0,0 +1,235 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// returned by ReadLine when the user presses Ctrl-C, so the REPL can throw
+// away whatever it has collected so far
+var errInterrupted = errors.New("interrupted")
+
+/*
+lineReader is where the REPL gets its input from. there are two of them:
+  - scannerReader reads plain lines, for pipes, files and tests
+  - editor puts a terminal into raw mode and does its own line editing,
+    which is what makes tab completion and highlighting possible
+*/
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// newLineReader only uses the editor when both ends are a terminal -
+// anything else gets the plain line-by-line reader
+func newLineReader(in io.Reader, out io.Writer, complete completeFunc, highlight highlightFunc) lineReader {
+	inFile, inOk := in.(*os.File)
+	outFile, outOk := out.(*os.File)
+
+	if inOk && outOk && isTerminal(inFile.Fd()) && isTerminal(outFile.Fd()) {
+		return &editor{in: inFile, reader: bufio.NewReader(inFile), out: out, complete: complete, highlight: highlight}
+	}
+
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (sr *scannerReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(sr.out, prompt)
+
+	if !sr.scanner.Scan() {
+		if err := sr.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	return sr.scanner.Text(), nil
+}
+
+/*
+completeFunc gets the line and the cursor position and returns the line
+with the word under the cursor completed as far as it unambiguously can
+be, the new cursor position and - when there's more than one match - the
+candidates to show
+*/
+type completeFunc func(line []rune, pos int) ([]rune, int, []string)
+
+// highlightFunc returns the line the way it should be shown: the same
+// text, with color codes added
+type highlightFunc func(line string) string
+
+type editor struct {
+	in        *os.File
+	reader    *bufio.Reader
+	out       io.Writer
+	complete  completeFunc
+	highlight highlightFunc
+}
+
+// key codes for the control characters the editor handles
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyEnter     = 13
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+/*
+ReadLine switches the terminal into raw mode only while a line is being
+typed, so whatever the evaluator prints in between goes through the
+terminal's normal output handling
+*/
+func (e *editor) ReadLine(prompt string) (string, error) {
+	state, err := makeRaw(e.in.Fd())
+	if err != nil {
+		return "", err
+	}
+	defer restoreTerminal(e.in.Fd(), state)
+
+	line := []rune{}
+	pos := 0
+
+	e.refresh(prompt, line, pos)
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			io.WriteString(e.out, "\r\n")
+			return string(line), nil
+
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+
+		case keyCtrlD:
+			if len(line) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+
+		case keyBackspace, keyCtrlH:
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+
+		case keyCtrlA:
+			pos = 0
+		case keyCtrlE:
+			pos = len(line)
+		case keyCtrlB:
+			if pos > 0 {
+				pos--
+			}
+		case keyCtrlF:
+			if pos < len(line) {
+				pos++
+			}
+		case keyCtrlK:
+			line = line[:pos]
+		case keyCtrlU:
+			line = line[pos:]
+			pos = 0
+
+		case keyTab:
+			var candidates []string
+			line, pos, candidates = e.complete(line, pos)
+			if len(candidates) > 1 {
+				io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+			}
+
+		case keyEscape:
+			line, pos = e.readEscape(line, pos)
+
+		default:
+			if r >= ' ' {
+				line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+				pos++
+			}
+		}
+
+		e.refresh(prompt, line, pos)
+	}
+}
+
+// handles the escape sequences terminals send for the arrow, home, end
+// and delete keys
+func (e *editor) readEscape(line []rune, pos int) ([]rune, int) {
+	r, _, err := e.reader.ReadRune()
+	if err != nil || r != '[' {
+		return line, pos
+	}
+
+	r, _, err = e.reader.ReadRune()
+	if err != nil {
+		return line, pos
+	}
+
+	switch r {
+	case 'C':
+		if pos < len(line) {
+			pos++
+		}
+	case 'D':
+		if pos > 0 {
+			pos--
+		}
+	case 'H':
+		pos = 0
+	case 'F':
+		pos = len(line)
+	case '3':
+		if next, _, err := e.reader.ReadRune(); err == nil && next == '~' && pos < len(line) {
+			line = append(line[:pos], line[pos+1:]...)
+		}
+	}
+
+	return line, pos
+}
+
+// redraws the whole line: back to column 0, prompt, (highlighted) line,
+// clear whatever was left over from before, then move the cursor back to
+// pos. the color codes don't move the cursor, so pos still works out
+func (e *editor) refresh(prompt string, line []rune, pos int) {
+	var out strings.Builder
+
+	out.WriteString("\r")
+	out.WriteString(prompt)
+	if e.highlight != nil {
+		out.WriteString(e.highlight(string(line)))
+	} else {
+		out.WriteString(string(line))
+	}
+	out.WriteString("\x1b[K")
+
+	if back := len(line) - pos; back > 0 {
+		fmt.Fprintf(&out, "\x1b[%dD", back)
+	}
+
+	io.WriteString(e.out, out.String())
+}
@@ -0,0 +1,147 @@
+package repl
+
+import (
+	"io"
+	"monkey/object"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ANSI escape codes for the colors the REPL uses
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorMagenta = "\x1b[35m"
+	colorGray    = "\x1b[90m"
+)
+
+// arrays and hashes that print longer than this get one element per line
+const maxInlineWidth = 60
+
+/*
+printer turns evaluation results into what the REPL shows, which is a bit
+different from Inspect():
+  - strings are quoted, so "5" and 5 look different
+  - big arrays and hashes are spread over several indented lines
+  - hash pairs are sorted, so the same hash always prints the same way
+  - with color on, every kind of value gets its own color and errors are red
+*/
+type printer struct {
+	color bool
+	width int // negative means never break arrays/hashes over lines
+}
+
+// newPrinter only turns colors on when out is a terminal and the user
+// hasn't opted out with NO_COLOR (https://no-color.org)
+func newPrinter(out io.Writer) *printer {
+	return &printer{color: useColor(out), width: maxInlineWidth}
+}
+
+func useColor(out io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (pr *printer) paint(color, s string) string {
+	if !pr.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func (pr *printer) format(obj object.Object) string {
+	return pr.formatIndent(obj, 0)
+}
+
+func (pr *printer) formatIndent(obj object.Object, indent int) string {
+	switch obj := obj.(type) {
+	case *object.String:
+		return pr.paint(colorGreen, strconv.Quote(obj.Value))
+	case *object.Integer, *object.Boolean:
+		return pr.paint(colorYellow, obj.Inspect())
+	case *object.Null:
+		return pr.paint(colorGray, obj.Inspect())
+	case *object.Error:
+		return pr.paint(colorRed, obj.Inspect())
+	case *object.Function, *object.Builtin:
+		return pr.paint(colorMagenta, obj.Inspect())
+	case *object.Array:
+		elements := []string{}
+		for _, el := range obj.Elements {
+			elements = append(elements, pr.formatIndent(el, indent+1))
+		}
+		return pr.formatList("[", "]", elements, pr.fitsInline(obj), indent)
+	case *object.Hash:
+		pairs := []string{}
+		for _, pair := range sortedPairs(obj) {
+			pairs = append(pairs, pr.formatIndent(pair.Key, indent+1)+": "+
+				pr.formatIndent(pair.Value, indent+1))
+		}
+		return pr.formatList("{", "}", pairs, pr.fitsInline(obj), indent)
+	default:
+		return obj.Inspect()
+	}
+}
+
+func (pr *printer) formatList(open, close string, items []string, inline bool, indent int) string {
+	if inline || len(items) == 0 {
+		return open + strings.Join(items, ", ") + close
+	}
+
+	var out strings.Builder
+
+	out.WriteString(open + "\n")
+	for _, item := range items {
+		out.WriteString(strings.Repeat("  ", indent+1))
+		out.WriteString(item)
+		out.WriteString(",\n")
+	}
+	out.WriteString(strings.Repeat("  ", indent) + close)
+
+	return out.String()
+}
+
+// measures the value printed on a single line without colors, since the
+// escape codes don't take up any room on screen
+func (pr *printer) fitsInline(obj object.Object) bool {
+	if pr.width < 0 {
+		return true
+	}
+
+	plain := &printer{width: -1}
+	s := plain.format(obj)
+
+	return len(s) <= pr.width && !strings.Contains(s, "\n")
+}
+
+func sortedPairs(hash *object.Hash) []object.HashPair {
+	plain := &printer{width: -1}
+
+	pairs := make([]object.HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return plain.format(pairs[i].Key) < plain.format(pairs[j].Key)
+	})
+
+	return pairs
+}
@@ -0,0 +1,76 @@
+package repl
+
+import (
+	"testing"
+
+	"monkey/object"
+)
+
+func TestPrinterFormat(t *testing.T) {
+	long := &object.Array{}
+	for i := 0; i < 30; i++ {
+		long.Elements = append(long.Elements, &object.Integer{Value: int64(i)})
+	}
+
+	hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+	for _, key := range []string{"b", "a", "c"} {
+		k := &object.String{Value: key}
+		hash.Pairs[k.HashKey()] = object.HashPair{Key: k, Value: &object.Integer{Value: 1}}
+	}
+
+	tests := []struct {
+		input    object.Object
+		expected string
+	}{
+		{&object.Integer{Value: 5}, "5"},
+		{&object.String{Value: "a \"b\""}, `"a \"b\""`},
+		{&object.Null{}, "null"},
+		{&object.Error{Message: "oops"}, "ERROR: oops"},
+		{&object.Array{}, "[]"},
+		{&object.Array{Elements: []object.Object{
+			&object.Integer{Value: 1}, &object.String{Value: "two"},
+		}}, `[1, "two"]`},
+		{hash, `{"a": 1, "b": 1, "c": 1}`},
+		{&object.Array{Elements: []object.Object{long}},
+			"[\n  [\n    0,\n    1,\n    2,\n    3,\n    4,\n    5,\n    6,\n    7,\n    8,\n    9,\n" +
+				"    10,\n    11,\n    12,\n    13,\n    14,\n    15,\n    16,\n    17,\n    18,\n    19,\n" +
+				"    20,\n    21,\n    22,\n    23,\n    24,\n    25,\n    26,\n    27,\n    28,\n    29,\n  ],\n]"},
+	}
+
+	pr := &printer{width: maxInlineWidth}
+
+	for _, tt := range tests {
+		if got := pr.format(tt.input); got != tt.expected {
+			t.Errorf("wrong output.\nexpected=%q\ngot=     %q", tt.expected, got)
+		}
+	}
+}
+
+func TestPrinterColor(t *testing.T) {
+	pr := &printer{color: true, width: maxInlineWidth}
+
+	tests := []struct {
+		input    object.Object
+		expected string
+	}{
+		{&object.Integer{Value: 5}, colorYellow + "5" + colorReset},
+		{&object.String{Value: "hi"}, colorGreen + `"hi"` + colorReset},
+		{&object.Error{Message: "oops"}, colorRed + "ERROR: oops" + colorReset},
+		{&object.Array{Elements: []object.Object{&object.Null{}}},
+			"[" + colorGray + "null" + colorReset + "]"},
+	}
+
+	for _, tt := range tests {
+		if got := pr.format(tt.input); got != tt.expected {
+			t.Errorf("wrong output.\nexpected=%q\ngot=     %q", tt.expected, got)
+		}
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+
+	if useColor(nil) {
+		t.Errorf("useColor should be false when NO_COLOR is set")
+	}
+}
@@ -1,30 +1,139 @@
 package repl
 
 import (
-	"bufio"
-	"fmt"
 	"io"
 	"monkey/lexer"
 	"monkey/token"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+// shown instead of PROMPT while we're still collecting the rest of an
+// unfinished input, e.g. after the first line of a function definition
+const CONTINUATION_PROMPT = "... "
+
+/*
+Config holds the settings a REPL can be started with:
+  - Prompt replaces PROMPT (an empty Prompt means PROMPT)
+  - StartupFile is evaluated before the first prompt, so helper
+    functions defined in it are ready to use. its results aren't printed
+    and it isn't part of what :save writes out
+*/
+type Config struct {
+	Prompt      string
+	StartupFile string
+}
+
+// Start runs a REPL with the default settings
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	StartWithConfig(in, out, Config{})
+}
+
+/*
+StartWithConfig reads a line, lexes and parses it and then evaluates the resulting
+program. the environment is created once, outside the loop, so that names
+bound with let on one line are still around on the next
+
+lines starting with a colon are REPL commands rather than code (see
+session.go). everything else is collected until the input looks complete
+(see isIncomplete), so a function can be typed over several lines. Ctrl-C
+throws away what has been collected and starts over with a fresh prompt
+*/
+func StartWithConfig(in io.Reader, out io.Writer, cfg Config) {
+	s := newSession(out)
+	defer s.close()
+
+	if cfg.Prompt == "" {
+		cfg.Prompt = PROMPT
+	}
+
+	if cfg.StartupFile != "" {
+		s.load(cfg.StartupFile)
+	}
+
+	reader := newLineReader(in, out, newCompleter(s.env), s.pr.highlight)
+
+	var input strings.Builder
 
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		prompt := cfg.Prompt
+		if input.Len() != 0 {
+			prompt = CONTINUATION_PROMPT
+		}
+
+		text, err := reader.ReadLine(prompt)
+		if err == errInterrupted {
+			input.Reset()
+			continue
+		}
+		if err != nil {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
+		if input.Len() == 0 && isCommand(text) {
+			s.command(text)
+			continue
+		}
+
+		input.WriteString(text)
+		input.WriteString("\n")
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+		if isIncomplete(input.String()) {
+			continue
 		}
+
+		line := input.String()
+		input.Reset()
+
+		s.eval(line)
 	}
 }
+
+func printParserErrors(out io.Writer, pr *printer, errors []string) {
+	io.WriteString(out, pr.paint(colorRed, "parser errors:")+"\n")
+	for _, msg := range errors {
+		io.WriteString(out, "\t"+pr.paint(colorRed, msg)+"\n")
+	}
+}
+
+/*
+isIncomplete reports whether the input so far can't be a whole program
+yet, either because a (, { or [ is still open or because the last token is
+an operator that needs a right hand side (e.g. "1 +")
+
+too many closing delimiters doesn't count as incomplete - more input can't
+fix that, so we let the parser report it
+*/
+func isIncomplete(input string) bool {
+	l := lexer.New(input)
+
+	depth := 0
+	var last token.Token
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+		last = tok
+	}
+
+	if depth > 0 {
+		return true
+	}
+	if depth < 0 {
+		return false
+	}
+
+	switch last.Type {
+	case token.ASSIGN, token.PLUS, token.MINUS, token.BANG, token.ASTERISK,
+		token.SLASH, token.LT, token.GT, token.EQ, token.NOT_EQ,
+		token.COMMA, token.COLON:
+		return true
+	}
+
+	return false
+}
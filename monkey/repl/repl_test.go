@@ -0,0 +1,118 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	input := `let add = fn(x, y) { x + y };
+add(1, 2)
+let x = 10;
+x * 2
+"a" + "b"
+5 + true
+let = 1;
+`
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := PROMPT +
+		PROMPT + "3\n" +
+		PROMPT +
+		PROMPT + "20\n" +
+		PROMPT + "\"ab\"\n" +
+		PROMPT + "ERROR: type mismatch: INTEGER + BOOLEAN\n" +
+		PROMPT + "parser errors:\n" +
+		"\texpected next token to be IDENT, got = instead\n" +
+		"\tno prefix parse function for = found\n" +
+		PROMPT
+
+	if out.String() != expected {
+		t.Errorf("wrong REPL output.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestStartMultiLine(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x +
+    y
+};
+add(1,
+2)
+`
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := PROMPT +
+		CONTINUATION_PROMPT +
+		CONTINUATION_PROMPT +
+		CONTINUATION_PROMPT +
+		PROMPT +
+		CONTINUATION_PROMPT + "3\n" +
+		PROMPT
+
+	if out.String() != expected {
+		t.Errorf("wrong REPL output.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", false},
+		{"let x =", true},
+		{"fn(x) {", true},
+		{"fn(x) { x }", false},
+		{"add(1,", true},
+		{"[1, 2", true},
+		{`{"a":`, true},
+		{"1 + 2 *", true},
+		{"}", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIncomplete(tt.input); got != tt.expected {
+			t.Errorf("isIncomplete(%q) wrong. expected=%t, got=%t",
+				tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStartWithConfig(t *testing.T) {
+	rc := filepath.Join(t.TempDir(), ".monkeyrc")
+	if err := os.WriteFile(rc, []byte("let double = fn(x) { x * 2 };\nlet ten = 10;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	StartWithConfig(strings.NewReader("double(ten)\n"), &out, Config{Prompt: "λ ", StartupFile: rc})
+
+	expected := "λ 20\nλ "
+	if out.String() != expected {
+		t.Errorf("wrong REPL output.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestStartupFileErrors(t *testing.T) {
+	rc := filepath.Join(t.TempDir(), "broken.mky")
+	if err := os.WriteFile(rc, []byte("let x = 1 + true;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	StartWithConfig(strings.NewReader(""), &out, Config{StartupFile: rc})
+
+	expected := rc + ": ERROR: type mismatch: INTEGER + BOOLEAN\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong REPL output.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
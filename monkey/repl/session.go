@@ -0,0 +1,227 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"os"
+	"strings"
+)
+
+/*
+session is the state of one REPL run: the environment, where output goes,
+and the inputs that evaluated without errors, which is what :save writes
+out and :record appends to a file as it goes
+
+the meta-commands all start with a colon, which can't start a monkey
+expression, so they can't be confused with code:
+
+	:save <file>     write every successful input so far to <file>
+	:record <file>   from now on, append each successful input to <file>
+	:record off      stop recording
+	:replay <file>   evaluate <file> as if it had been typed in
+*/
+type session struct {
+	env *object.Environment
+	out io.Writer
+	pr  *printer
+
+	history   []string
+	recording *os.File
+}
+
+func newSession(out io.Writer) *session {
+	return &session{
+		env: object.NewEnvironment(),
+		out: out,
+		pr:  newPrinter(out),
+	}
+}
+
+// eval runs one complete input, prints the result and remembers the input
+// if nothing went wrong
+func (s *session) eval(input string) {
+	evaluated, ok := s.evalQuiet(input)
+	if evaluated != nil {
+		io.WriteString(s.out, s.pr.format(evaluated))
+		io.WriteString(s.out, "\n")
+	}
+
+	if ok {
+		s.remember(input)
+	}
+}
+
+// evalQuiet parses and evaluates input without printing the result. parser
+// errors are still printed; ok is false if there were any, or if evaluation
+// ended in an error
+func (s *session) evalQuiet(input string) (evaluated object.Object, ok bool) {
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, s.pr, p.Errors())
+		return nil, false
+	}
+
+	evaluated = evaluator.Eval(program, s.env)
+	_, isErr := evaluated.(*object.Error)
+
+	return evaluated, !isErr
+}
+
+// load evaluates a startup file, only saying something if it goes wrong
+func (s *session) load(path string) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		s.errorf("%s", err)
+		return
+	}
+
+	if evaluated, ok := s.evalQuiet(string(src)); !ok && evaluated != nil {
+		s.errorf("%s: %s", path, evaluated.Inspect())
+	}
+}
+
+func (s *session) remember(input string) {
+	input = asStatement(input)
+	s.history = append(s.history, input)
+
+	if s.recording != nil {
+		if _, err := io.WriteString(s.recording, input); err != nil {
+			s.errorf("recording to %s failed: %s", s.recording.Name(), err)
+			s.stopRecording()
+		}
+	}
+}
+
+/*
+inputs are written out one after another, so each one has to end in a
+semicolon - otherwise "x" followed by "-1" on the next line would come back
+as x - 1. the semicolon goes after the code, before any comments at the
+end: at the very end it would be part of the last one
+*/
+func asStatement(input string) string {
+	trimmed := strings.TrimSpace(input)
+	code := strings.TrimRight(trimmed[:codeEnd(trimmed)], " \t\r\n")
+	if code != "" && !strings.HasSuffix(code, ";") {
+		trimmed = code + ";" + trimmed[len(code):]
+	}
+	return trimmed + "\n"
+}
+
+// codeEnd is the offset in input of the first comment after the last
+// token, or len(input) if it doesn't end with comments
+func codeEnd(input string) int {
+	l := lexer.New(input)
+	var last token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		last = tok
+	}
+
+	lineStarts := []int{0}
+	for i, ch := range []byte(input) {
+		if ch == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	for _, c := range l.Comments() {
+		if c.Line > last.Line || (c.Line == last.Line && c.Column > last.Column) {
+			return lineStarts[c.Line-1] + c.Column - 1
+		}
+	}
+	return len(input)
+}
+
+func isCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), ":")
+}
+
+func (s *session) command(line string) {
+	fields := strings.Fields(strings.TrimSpace(line))
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case ":save":
+		if len(args) != 1 {
+			s.errorf("usage: :save <file>")
+			return
+		}
+		s.save(args[0])
+
+	case ":record":
+		if len(args) != 1 {
+			s.errorf("usage: :record <file> | :record off")
+			return
+		}
+		if args[0] == "off" {
+			s.stopRecording()
+			return
+		}
+		s.startRecording(args[0])
+
+	case ":replay":
+		if len(args) != 1 {
+			s.errorf("usage: :replay <file>")
+			return
+		}
+		s.replay(args[0])
+
+	default:
+		s.errorf("unknown command %s (try :save, :record or :replay)", name)
+	}
+}
+
+func (s *session) save(path string) {
+	if err := os.WriteFile(path, []byte(strings.Join(s.history, "")), 0644); err != nil {
+		s.errorf("%s", err)
+		return
+	}
+	fmt.Fprintf(s.out, "saved %d inputs to %s\n", len(s.history), path)
+}
+
+func (s *session) startRecording(path string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		s.errorf("%s", err)
+		return
+	}
+
+	s.stopRecording()
+	s.recording = f
+	fmt.Fprintf(s.out, "recording to %s\n", path)
+}
+
+func (s *session) stopRecording() {
+	if s.recording == nil {
+		return
+	}
+	s.recording.Close()
+	fmt.Fprintf(s.out, "stopped recording to %s\n", s.recording.Name())
+	s.recording = nil
+}
+
+// the whole file is evaluated as a single input, so only the value of its
+// last statement gets printed
+func (s *session) replay(path string) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		s.errorf("%s", err)
+		return
+	}
+	s.eval(string(src))
+}
+
+func (s *session) close() {
+	s.stopRecording()
+}
+
+func (s *session) errorf(format string, a ...interface{}) {
+	io.WriteString(s.out, s.pr.paint(colorRed, fmt.Sprintf(format, a...))+"\n")
+}
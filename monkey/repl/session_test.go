@@ -0,0 +1,128 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.mky")
+
+	input := `let add = fn(x, y) {
+  x + y
+}
+add(1, true)
+let = 1;
+add(1, 2)
+:save ` + path + `
+`
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("session wasn't saved: %s", err)
+	}
+
+	expected := "let add = fn(x, y) {\n  x + y\n};\nadd(1, 2);\n"
+	if string(saved) != expected {
+		t.Errorf("wrong session saved.\nexpected=%q\ngot=     %q", expected, string(saved))
+	}
+
+	if !strings.Contains(out.String(), "saved 2 inputs to "+path) {
+		t.Errorf("missing save confirmation. got=%q", out.String())
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recorded.mky")
+
+	input := `let a = 1;
+:record ` + path + `
+let b = a + 1;
+b + undefined
+let c = b * 10
+:record off
+let d = 4;
+`
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	recorded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("nothing recorded: %s", err)
+	}
+
+	expected := "let b = a + 1;\nlet c = b * 10;\n"
+	if string(recorded) != expected {
+		t.Errorf("wrong recording.\nexpected=%q\ngot=     %q", expected, string(recorded))
+	}
+
+	out.Reset()
+	Start(strings.NewReader("let a = 5;\n:replay "+path+"\nc\n"), &out)
+
+	if !strings.Contains(out.String(), PROMPT+"60\n") {
+		t.Errorf("replayed bindings missing. got=%q", out.String())
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader(":nope\n"), &out)
+
+	expected := PROMPT + "unknown command :nope (try :save, :record or :replay)\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestAsStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x", "x;\n"},
+		{"x;  ", "x;\n"},
+		{"x // hi", "x; // hi\n"},
+		{"x; // hi", "x; // hi\n"},
+		{"let f = fn() {\n  1 // one\n}\n// done", "let f = fn() {\n  1 // one\n};\n// done\n"},
+		{`"// not a comment"`, `"// not a comment";` + "\n"},
+		{"// just a comment", "// just a comment\n"},
+	}
+
+	for _, tt := range tests {
+		if got := asStatement(tt.input); got != tt.expected {
+			t.Errorf("asStatement(%q) wrong.\nexpected=%q\ngot=     %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// a comment at the end of an input mustn't swallow the ; that keeps it
+// apart from the next one
+func TestSaveWithComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.mky")
+
+	var out bytes.Buffer
+	Start(strings.NewReader("let x = 5\nlet y = x // hi\n-1\n:save "+path+"\n"), &out)
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("session wasn't saved: %s", err)
+	}
+	expected := "let x = 5;\nlet y = x; // hi\n-1;\n"
+	if string(saved) != expected {
+		t.Errorf("wrong session saved.\nexpected=%q\ngot=     %q", expected, string(saved))
+	}
+
+	out.Reset()
+	// with the ; in the comment it would come back as let y = x - 1
+	Start(strings.NewReader(":replay "+path+"\ny\n"), &out)
+	if !strings.Contains(out.String(), PROMPT+"5\n") {
+		t.Errorf("wrong value after replaying. got=%q", out.String())
+	}
+}
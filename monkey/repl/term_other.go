@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package repl
+
+import "errors"
+
+// on platforms we don't know how to put into raw mode the REPL just falls
+// back to reading whole lines, so there is no line editing or completion
+
+type terminalState struct{}
+
+func makeRaw(fd uintptr) (*terminalState, error) {
+	return nil, errors.New("raw terminal mode not supported on this platform")
+}
+
+func restoreTerminal(fd uintptr, state *terminalState) error {
+	return nil
+}
+
+func isTerminal(fd uintptr) bool {
+	return false
+}
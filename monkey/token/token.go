@@ -2,11 +2,15 @@
 
 package token
 
+import "sort"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // 1-based line the token starts on
+	Column  int // 1-based column (in bytes) the token starts at
 }
 
 /*
@@ -17,11 +21,13 @@ as constants
 
 const (
 	ILLEGAL = "ILLEGAL" // signifies a token/character we dont know about
+	COMMENT = "COMMENT" // a // comment, which the lexer keeps to the side (see Lexer.Comments)
 	EOF     = "EOF"     // stands for "end of file", which tells the parser that it can stop
 
 	// identifiers + literals
-	IDENT = "IDENT" // identifiers like add, x, y
-	INT   = "INT"   // 123456
+	IDENT  = "IDENT"  // identifiers like add, x, y
+	INT    = "INT"    // 123456
+	STRING = "STRING" // "foobar"
 
 	// Operators
 	ASSIGN   = "="
@@ -37,12 +43,16 @@ const (
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
 	RBRACE = "}"
 
+	LBRACKET = "["
+	RBRACKET = "]"
+
 	// Keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
@@ -63,8 +73,27 @@ var keywords = map[string]TokenType{
 	"true":   TRUE,
 	"else":   ELSE,
 	"false":  FALSE,
-	"==":     EQ,
-	"!=":     NOT_EQ,
+}
+
+// Keywords lists the reserved words in alphabetical order (the REPL uses
+// it for tab completion)
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// IsKeyword reports whether t is the type of one of the reserved words
+func IsKeyword(t TokenType) bool {
+	for _, kw := range keywords {
+		if kw == t {
+			return true
+		}
+	}
+	return false
 }
 
 func LookupIdent(ident string) TokenType {
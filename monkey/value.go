@@ -0,0 +1,417 @@
+package monkey
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"monkey/object"
+	"reflect"
+)
+
+/*
+ToValue turns a go value into the monkey one a program would see, so
+data can be handed to a program without building the objects by hand
+(see Interpreter.Set):
+
+  - nil and nil pointers, slices and maps are null
+  - bools, strings and all the integer types become what they are in
+    monkey. an unsigned number too big for an int64 is an error
+  - slices and arrays become arrays, maps become hashes. a map's keys have
+    to become something a hash can have as a key: a string, an integer or
+    a boolean
+  - a struct becomes a hash with a string key per exported field. the
+    `monkey:"name"` tag gives the key a different name, `monkey:"-"`
+    leaves the field out
+  - pointers and interfaces stand for what they point to, an object.Object
+    or a Value is used as it is
+
+anything else (floats, functions, channels) has no monkey counterpart and
+is an error, as is a value that contains itself
+*/
+func ToValue(v any) (object.Object, error) {
+	obj, err := toValue(reflect.ValueOf(v), 0)
+	if err != nil {
+		return nil, fmt.Errorf("monkey: %w", err)
+	}
+	return obj, nil
+}
+
+// deeper than this and it's taken to be a value that contains itself,
+// which would go around forever
+const maxConvertDepth = 1000
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	valueType  = reflect.TypeOf(Value{})
+)
+
+func toValue(rv reflect.Value, depth int) (object.Object, error) {
+	if depth > maxConvertDepth {
+		return nil, errors.New("value nests too deep (does it contain itself?)")
+	}
+
+	if !rv.IsValid() {
+		return object.NULL, nil
+	}
+
+	if rv.Type() == valueType {
+		v := rv.Interface().(Value)
+		if v.obj == nil {
+			return object.NULL, nil
+		}
+		return v.obj, nil
+	}
+	if rv.Type().Implements(objectType) {
+		if (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && rv.IsNil() {
+			return object.NULL, nil
+		}
+		return rv.Interface().(object.Object), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return object.TRUE, nil
+		}
+		return object.FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: rv.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d doesn't fit in an integer", rv.Uint())
+		}
+		return &object.Integer{Value: int64(rv.Uint())}, nil
+
+	case reflect.String:
+		return &object.String{Value: rv.String()}, nil
+
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return object.NULL, nil
+		}
+		return toValue(rv.Elem(), depth+1)
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return object.NULL, nil
+		}
+
+		elements := make([]object.Object, rv.Len())
+		for i := range elements {
+			element, err := toValue(rv.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return object.NULL, nil
+		}
+
+		pairs := make(map[object.HashKey]object.HashPair, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := toValue(iter.Key(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+
+			value, err := toValue(iter.Value(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+
+	case reflect.Struct:
+		pairs := map[object.HashKey]object.HashPair{}
+		for _, field := range fieldsOf(rv.Type()) {
+			value, err := toValue(rv.Field(field.index), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			key := &object.String{Value: field.name}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	}
+
+	return nil, fmt.Errorf("can't convert %s to a monkey value", rv.Type())
+}
+
+type field struct {
+	name  string
+	index int
+}
+
+// the exported fields of t under the names they have in a hash
+func fieldsOf(t reflect.Type) []field {
+	fields := []field{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Tag.Get("monkey")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, field{name: name, index: i})
+	}
+	return fields
+}
+
+/*
+FromValue is ToValue the other way around: it stores obj in what dst
+points to, converting it to dst's type the way ToValue would have
+converted that type to obj. on top of that
+
+  - null sets dst to its zero value
+  - a hash fills in a struct's fields by their names (or tags), keys
+    without a field are ignored
+  - an integer that doesn't fit the type of dst is an error
+  - dst can be an object.Object (or *object.Hash, ...), which gets obj as
+    it is - the only way to get at functions
+
+into an `any` an integer goes as an int64, an array as a []any and a hash
+as a map[string]any, or a map[any]any when not all its keys are strings
+
+arrays a program made can share elements - [a, a] with a = [b, b] and so
+on - while the go values made of them each get their own copy, which is
+twice as much for every level. more than maxConvertValues values is an
+error rather than all the memory there is
+*/
+func FromValue(obj object.Object, dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("monkey: FromValue needs a non-nil pointer, got %T", dst)
+	}
+	if obj == nil {
+		obj = object.NULL
+	}
+	n := 0
+	if err := fromValue(obj, rv.Elem(), &n); err != nil {
+		return fmt.Errorf("monkey: %w", err)
+	}
+	return nil
+}
+
+// the most values FromValue makes
+const maxConvertValues = 1 << 22
+
+var errTooBig = fmt.Errorf("value is too big to convert (more than %d values)", maxConvertValues)
+
+// n counts the values converted so far
+func fromValue(obj object.Object, rv reflect.Value, n *int) error {
+	if *n++; *n > maxConvertValues {
+		return errTooBig
+	}
+
+	t := rv.Type()
+
+	// an object.Object, or the very kind of object obj is (but an `any`
+	// gets a go value)
+	isAny := t.Kind() == reflect.Interface && t.NumMethod() == 0
+	if !isAny && reflect.TypeOf(obj).AssignableTo(t) {
+		rv.Set(reflect.ValueOf(obj))
+		return nil
+	}
+	if t == valueType {
+		rv.Set(reflect.ValueOf(Value{obj: obj}))
+		return nil
+	}
+
+	if obj.Type() == object.NULL_OBJ {
+		rv.SetZero()
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		ptr := reflect.New(t.Elem())
+		if err := fromValue(obj, ptr.Elem(), n); err != nil {
+			return err
+		}
+		rv.Set(ptr)
+		return nil
+
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			break
+		}
+		native, err := toNative(obj, n)
+		if err != nil {
+			return err
+		}
+		if native != nil {
+			rv.Set(reflect.ValueOf(native))
+		}
+		return nil
+	}
+
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		if rv.Kind() == reflect.Bool {
+			rv.SetBool(obj.Value)
+			return nil
+		}
+
+	case *object.Integer:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if rv.OverflowInt(obj.Value) {
+				return fmt.Errorf("%d doesn't fit in %s", obj.Value, t)
+			}
+			rv.SetInt(obj.Value)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if obj.Value < 0 || rv.OverflowUint(uint64(obj.Value)) {
+				return fmt.Errorf("%d doesn't fit in %s", obj.Value, t)
+			}
+			rv.SetUint(uint64(obj.Value))
+			return nil
+		}
+
+	case *object.String:
+		if rv.Kind() == reflect.String {
+			rv.SetString(obj.Value)
+			return nil
+		}
+
+	case *object.Array:
+		switch rv.Kind() {
+		case reflect.Slice:
+			slice := reflect.MakeSlice(t, len(obj.Elements), len(obj.Elements))
+			for i, element := range obj.Elements {
+				if err := fromValue(element, slice.Index(i), n); err != nil {
+					return err
+				}
+			}
+			rv.Set(slice)
+			return nil
+		case reflect.Array:
+			if rv.Len() != len(obj.Elements) {
+				return fmt.Errorf("an array of %d elements doesn't fit in %s", len(obj.Elements), t)
+			}
+			for i, element := range obj.Elements {
+				if err := fromValue(element, rv.Index(i), n); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+	case *object.Hash:
+		switch rv.Kind() {
+		case reflect.Map:
+			m := reflect.MakeMapWithSize(t, len(obj.Pairs))
+			for _, pair := range obj.Pairs {
+				key := reflect.New(t.Key()).Elem()
+				if err := fromValue(pair.Key, key, n); err != nil {
+					return err
+				}
+				value := reflect.New(t.Elem()).Elem()
+				if err := fromValue(pair.Value, value, n); err != nil {
+					return err
+				}
+				m.SetMapIndex(key, value)
+			}
+			rv.Set(m)
+			return nil
+		case reflect.Struct:
+			for _, field := range fieldsOf(t) {
+				key := &object.String{Value: field.name}
+				pair, ok := obj.Pairs[key.HashKey()]
+				if !ok {
+					continue
+				}
+				if err := fromValue(pair.Value, rv.Field(field.index), n); err != nil {
+					return fmt.Errorf("%w (field %s)", err, t.Field(field.index).Name)
+				}
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("can't convert %s to %s", obj.Type(), t)
+}
+
+// toNative is what FromValue puts in an `any`
+func toNative(obj object.Object, n *int) (any, error) {
+	if *n++; *n > maxConvertValues {
+		return nil, errTooBig
+	}
+
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+
+	case *object.Array:
+		elements := make([]any, len(obj.Elements))
+		for i, element := range obj.Elements {
+			native, err := toNative(element, n)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = native
+		}
+		return elements, nil
+
+	case *object.Hash:
+		allStrings := true
+		for _, pair := range obj.Pairs {
+			if pair.Key.Type() != object.STRING_OBJ {
+				allStrings = false
+				break
+			}
+		}
+
+		if allStrings {
+			m := make(map[string]any, len(obj.Pairs))
+			for _, pair := range obj.Pairs {
+				value, err := toNative(pair.Value, n)
+				if err != nil {
+					return nil, err
+				}
+				m[pair.Key.(*object.String).Value] = value
+			}
+			return m, nil
+		}
+
+		m := make(map[any]any, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, err := toNative(pair.Key, n)
+			if err != nil {
+				return nil, err
+			}
+			value, err := toNative(pair.Value, n)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("can't convert %s to a go value", obj.Type())
+}
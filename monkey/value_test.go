@@ -0,0 +1,275 @@
+package monkey
+
+import (
+	"monkey/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type user struct {
+	Name    string
+	Age     int  `monkey:"age"`
+	Admin   bool `monkey:"-"`
+	Tags    []string
+	Manager *user
+	secret  string
+}
+
+func TestToValue(t *testing.T) {
+	ann := &user{Name: "ann", Age: 37, Admin: true, Tags: []string{"a"}, secret: "x"}
+
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{-3, "-3"},
+		{true, "true"},
+		{"hi", "hi"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]any{1, "a", nil, false}, "[1, a, null, false]"},
+		{[]int(nil), "null"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{map[int]bool{1: true}, "{1: true}"},
+		{(*user)(nil), "null"},
+		{Value{}, "null"},
+		{&object.Integer{Value: 5}, "5"},
+		{struct{ Inner struct{ X int } }{}, "{Inner: {X: 0}}"},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToValue(tt.input)
+		if err != nil {
+			t.Fatalf("%#v: unexpected error: %s", tt.input, err)
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("%#v: wrong value. want=%s, got=%s", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	// hashes of more than one pair print in no particular order
+	obj, err := ToValue(ann)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	hash, ok := obj.(*object.Hash)
+	if !ok {
+		t.Fatalf("a struct should be a hash. got=%T", obj)
+	}
+	expected := map[string]string{"Name": "ann", "age": "37", "Tags": "[a]", "Manager": "null"}
+	if len(hash.Pairs) != len(expected) {
+		t.Errorf("wrong number of pairs. want=%d, got=%d (%s)", len(expected), len(hash.Pairs), hash.Inspect())
+	}
+	for key, value := range expected {
+		pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+		if !ok {
+			t.Errorf("no pair for %s", key)
+			continue
+		}
+		if pair.Value.Inspect() != value {
+			t.Errorf("%s: wrong value. want=%s, got=%s", key, value, pair.Value.Inspect())
+		}
+	}
+
+	// booleans have to be the engines' own, so they compare by pointer
+	if obj, _ := ToValue(false); obj != object.FALSE {
+		t.Errorf("false should be object.FALSE. got=%p", obj)
+	}
+}
+
+func TestToValueErrors(t *testing.T) {
+	type node struct{ Next *node }
+	loop := &node{}
+	loop.Next = loop
+
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{1.5, "can't convert float64"},
+		{[]any{1, func() {}}, "can't convert func()"},
+		{uint64(1 << 63), "doesn't fit in an integer"},
+		{map[[2]int]int{{1, 2}: 3}, "unusable as hash key: ARRAY"},
+		{loop, "nests too deep"},
+	}
+
+	for _, tt := range tests {
+		_, err := ToValue(tt.input)
+		if err == nil {
+			t.Errorf("%T: expected an error", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%T: wrong error. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestFromValue(t *testing.T) {
+	interp := New()
+
+	eval := func(src string) object.Object {
+		v, err := interp.Eval(src)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", src, err)
+		}
+		return v.Object()
+	}
+
+	var n int
+	if err := FromValue(eval("1 + 2"), &n); err != nil || n != 3 {
+		t.Errorf("int: want=3, got=%d (%v)", n, err)
+	}
+
+	var s string
+	if err := FromValue(eval(`"a" + "b"`), &s); err != nil || s != "ab" {
+		t.Errorf("string: want=ab, got=%q (%v)", s, err)
+	}
+
+	var ints []int8
+	if err := FromValue(eval("[1, 2, 3]"), &ints); err != nil || !reflect.DeepEqual(ints, []int8{1, 2, 3}) {
+		t.Errorf("slice: got=%v (%v)", ints, err)
+	}
+
+	var pair [2]bool
+	if err := FromValue(eval("[true, false]"), &pair); err != nil || pair != [2]bool{true, false} {
+		t.Errorf("array: got=%v (%v)", pair, err)
+	}
+
+	var m map[string]int
+	if err := FromValue(eval(`{"a": 1, "b": 2}`), &m); err != nil || !reflect.DeepEqual(m, map[string]int{"a": 1, "b": 2}) {
+		t.Errorf("map: got=%v (%v)", m, err)
+	}
+
+	var u user
+	err := FromValue(eval(`{"Name": "bob", "age": 40, "Admin": true, "Manager": {"Name": "ann"}, "other": 1}`), &u)
+	if err != nil {
+		t.Fatalf("struct: unexpected error: %s", err)
+	}
+	want := user{Name: "bob", Age: 40, Manager: &user{Name: "ann"}}
+	if !reflect.DeepEqual(u, want) {
+		t.Errorf("struct: want=%+v, got=%+v", want, u)
+	}
+
+	var native any
+	if err := FromValue(eval(`{"a": [1, "x", if (false) { 1 }]}`), &native); err != nil {
+		t.Fatalf("any: unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(native, map[string]any{"a": []any{int64(1), "x", nil}}) {
+		t.Errorf("any: got=%#v", native)
+	}
+	if err := FromValue(eval(`{1: true}`), &native); err != nil || !reflect.DeepEqual(native, map[any]any{int64(1): true}) {
+		t.Errorf("any with integer keys: got=%#v (%v)", native, err)
+	}
+
+	n = 5
+	if err := FromValue(eval("if (false) { 1 }"), &n); err != nil || n != 0 {
+		t.Errorf("null: want=0, got=%d (%v)", n, err)
+	}
+
+	var fn object.Object
+	if err := FromValue(eval("fn(x) { x }"), &fn); err != nil || fn.Type() != object.FUNCTION_OBJ {
+		t.Errorf("object: got=%v (%v)", fn, err)
+	}
+
+	var v Value
+	if err := FromValue(eval("[1]"), &v); err != nil || v.String() != "[1]" {
+		t.Errorf("value: got=%s (%v)", v, err)
+	}
+}
+
+func TestFromValueErrors(t *testing.T) {
+	var n int
+	var b byte
+	var s string
+	var pair [2]int
+	var ints []int
+	var u user
+	var fn any
+	var native any
+
+	// 2^40 ones, in 40 arrays
+	var nested object.Object = &object.Integer{Value: 1}
+	for i := 0; i < 40; i++ {
+		nested = &object.Array{Elements: []object.Object{nested, nested}}
+	}
+
+	tests := []struct {
+		obj      object.Object
+		dst      any
+		expected string
+	}{
+		{&object.Integer{Value: 1}, n, "needs a non-nil pointer, got int"},
+		{&object.Integer{Value: 1}, nil, "needs a non-nil pointer"},
+		{&object.String{Value: "a"}, &n, "can't convert STRING to int"},
+		{&object.Integer{Value: 256}, &b, "256 doesn't fit in uint8"},
+		{&object.Integer{Value: -1}, &b, "-1 doesn't fit in uint8"},
+		{object.TRUE, &s, "can't convert BOOLEAN to string"},
+		{&object.Array{Elements: []object.Object{object.TRUE}}, &pair, "an array of 1 elements doesn't fit in [2]int"},
+		{&object.Array{Elements: []object.Object{object.TRUE}}, &ints, "can't convert BOOLEAN to int"},
+		{mustToValue(t, map[string]any{"age": "old"}), &u, "can't convert STRING to int (field Age)"},
+		{&object.Function{}, &fn, "can't convert FUNCTION to a go value"},
+		{nested, &native, "value is too big to convert (more than 4194304 values)"},
+	}
+
+	for _, tt := range tests {
+		err := FromValue(tt.obj, tt.dst)
+		if err == nil {
+			t.Errorf("%s into %T: expected an error", tt.obj.Type(), tt.dst)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s into %T: wrong error. want=%q, got=%q", tt.obj.Type(), tt.dst, tt.expected, err)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	for name, interp := range engines() {
+		if err := interp.Set("user", user{Name: "ann", Age: 37, Tags: []string{"a", "b"}}); err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if err := interp.Set("flag", true); err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+
+		v, err := interp.Eval(`let next = fn() { user["age"] + 1 }; [next(), len(user["Tags"]), flag == true, !flag]`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		var got []any
+		if err := v.Decode(&got); err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if !reflect.DeepEqual(got, []any{int64(38), int64(2), true, false}) {
+			t.Errorf("%s: wrong value. got=%#v", name, got)
+		}
+
+		// setting it again changes what the functions already defined see
+		interp.Set("user", map[string]int{"age": 1})
+		v, err = interp.Eval("next()")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if v.String() != "2" {
+			t.Errorf("%s: wrong value after Set. want=2, got=%s", name, v)
+		}
+
+		if err := interp.Set("f", 1.5); err == nil {
+			t.Errorf("%s: expected an error for a float", name)
+		}
+	}
+}
+
+func mustToValue(t *testing.T, v any) object.Object {
+	t.Helper()
+	obj, err := ToValue(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
@@ -0,0 +1,310 @@
+package vet
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"strings"
+)
+
+var Unused = &Rule{
+	Name: "unused",
+	Doc:  "report lets in functions that are never used (names starting with _ are left alone)",
+	check: func(p *pass) {
+		if p.program == nil {
+			return
+		}
+		for _, b := range p.resolution().bindings {
+			// a global might be there for whoever loads the file, like a
+			// ~/.monkeyrc is for the REPL
+			if !b.param && !b.global && !b.used && !strings.HasPrefix(b.name, "_") {
+				p.report(b.token, "%s is never used", b.name)
+			}
+		}
+	},
+}
+
+var Shadow = &Rule{
+	Name: "shadow",
+	Doc:  "report lets that hide a name from an enclosing function, or a builtin",
+	check: func(p *pass) {
+		if p.program == nil {
+			return
+		}
+		for _, b := range p.resolution().bindings {
+			switch {
+			case b.param:
+			case b.shadows != nil:
+				p.report(b.token, "%s shadows the %s from line %d", b.name, b.name, b.shadows.token.Line)
+			case b.builtin:
+				p.report(b.token, "%s shadows the builtin %s", b.name, b.name)
+			}
+		}
+	},
+}
+
+var Unreachable = &Rule{
+	Name: "unreachable",
+	Doc:  "report statements that come after a return",
+	check: func(p *pass) {
+		if p.program == nil {
+			return
+		}
+		unreachable(p, p.program.Statements)
+		ast.Inspect(p.program, func(node ast.Node) bool {
+			if block, ok := node.(*ast.BlockStatement); ok {
+				unreachable(p, block.Statements)
+			}
+			return true
+		})
+	},
+}
+
+// only the first statement that can't be reached is reported, the rest
+// goes with it
+func unreachable(p *pass, stmts []ast.Statement) {
+	for i, stmt := range stmts {
+		if terminates(stmt) && i+1 < len(stmts) {
+			p.report(statementToken(stmts[i+1]), "unreachable code")
+			return
+		}
+	}
+}
+
+// whether nothing after stmt runs: a return, or an if that returns
+// whichever way it goes
+func terminates(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement:
+		return true
+	case *ast.ExpressionStatement:
+		ifExp, ok := stmt.Expression.(*ast.IfExpression)
+		if !ok || ifExp.Alternative == nil {
+			return false
+		}
+		return blockTerminates(ifExp.Consequence) && blockTerminates(ifExp.Alternative)
+	}
+	return false
+}
+
+func blockTerminates(block *ast.BlockStatement) bool {
+	for _, stmt := range block.Statements {
+		if terminates(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+var Constant = &Rule{
+	Name: "constant",
+	Doc:  "report if conditions that are always true or always false",
+	check: func(p *pass) {
+		if p.program == nil {
+			return
+		}
+		ast.Inspect(p.program, func(node ast.Node) bool {
+			ifExp, ok := node.(*ast.IfExpression)
+			if !ok || !isConstant(ifExp.Condition) {
+				return true
+			}
+
+			// with nothing in it that could change, the evaluator can just
+			// tell what the condition comes out as
+			value := evaluator.Eval(ifExp.Condition, object.NewEnvironment())
+			if _, isErr := value.(*object.Error); isErr {
+				return true
+			}
+			truthy := value != object.FALSE && value != object.NULL
+			p.report(ifExp.Token, "condition is always %t", truthy)
+			return true
+		})
+	},
+}
+
+// a constant expression has no names in it, so it can't depend on
+// anything. a function literal is constant too - it's always truthy,
+// whatever it does
+func isConstant(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean, *ast.FunctionLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return isConstant(e.Right)
+	case *ast.InfixExpression:
+		return isConstant(e.Left) && isConstant(e.Right)
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			if !isConstant(el) {
+				return false
+			}
+		}
+		return true
+	case *ast.HashLiteral:
+		for _, key := range e.Keys {
+			if !isConstant(key) || !isConstant(e.Pairs[key]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+/*
+there's no assignment in monkey beyond let, so if (x = 1) doesn't even
+parse - but the parser's complaint (it wanted a `)`) doesn't point at the
+real mistake. this rule looks at the tokens instead of the tree, for a =
+that's directly inside the condition's parentheses
+*/
+var Assign = &Rule{
+	Name: "assign",
+	Doc:  "report = in an if condition, where == was probably meant",
+	check: func(p *pass) {
+		for i, tok := range p.tokens {
+			if tok.Type != token.IF || i+1 >= len(p.tokens) || p.tokens[i+1].Type != token.LPAREN {
+				continue
+			}
+
+			depth := 0
+			for _, t := range p.tokens[i+1:] {
+				switch t.Type {
+				case token.LPAREN, token.LBRACE, token.LBRACKET:
+					depth++
+				case token.RPAREN, token.RBRACE, token.RBRACKET:
+					depth--
+				case token.ASSIGN:
+					if depth == 1 {
+						p.report(t, "= in a condition, did you mean ==?")
+					}
+				}
+				if depth == 0 || t.Type == token.EOF {
+					break
+				}
+			}
+		}
+	},
+}
+
+/*
+the scopes work like the evaluator's environments: a function gets one
+(with its parameters in it), nothing else does - a let in an if's block
+is a let in the function around it. a let of a function is defined
+before its value so it can call itself; any other let only after, so
+let x = x + 1 reads the x from before
+*/
+type binding struct {
+	name   string
+	token  token.Token // the name in the let or parameter list
+	param  bool
+	global bool
+
+	used     bool
+	defining bool     // its value is being walked, where it calling itself isn't a use
+	shadows  *binding // the binding of the same name outside the function
+	builtin  bool     // it has the name of a builtin, which it hides
+}
+
+type scope struct {
+	names map[string]*binding
+	outer *scope
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.names[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+type resolution struct {
+	bindings []*binding // in the order they're defined
+
+	// names used in a function before anything by that name was defined,
+	// which a let further down may still define before the function runs
+	later []laterName
+}
+
+type laterName struct {
+	name  string
+	scope *scope
+}
+
+func resolve(program *ast.Program) *resolution {
+	r := &resolution{}
+	global := &scope{names: map[string]*binding{}}
+	for _, stmt := range program.Statements {
+		r.walk(stmt, global)
+	}
+
+	for _, l := range r.later {
+		if b := l.scope.lookup(l.name); b != nil {
+			b.used = true
+		}
+	}
+	return r
+}
+
+func (r *resolution) define(s *scope, name *ast.Identifier, param bool) *binding {
+	b := &binding{name: name.Value, token: name.Token, param: param, global: s.outer == nil}
+	if s.outer != nil {
+		b.shadows = s.outer.lookup(name.Value)
+	}
+	if b.shadows == nil && s.lookup(name.Value) == nil {
+		b.builtin = object.GetBuiltinByName(name.Value) != nil
+	}
+
+	s.names[name.Value] = b
+	r.bindings = append(r.bindings, b)
+	return b
+}
+
+// walk leaves the nodes that don't define or use a name to ast.Inspect
+func (r *resolution) walk(node ast.Node, s *scope) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if _, isFn := node.Value.(*ast.FunctionLiteral); isFn {
+				b := r.define(s, node.Name, false)
+				b.defining = true
+				r.walk(node.Value, s)
+				b.defining = false
+			} else {
+				r.walk(node.Value, s)
+				r.define(s, node.Name, false)
+			}
+			return false
+
+		case *ast.Identifier:
+			if b := s.lookup(node.Value); b != nil {
+				b.used = b.used || !b.defining
+			} else {
+				r.later = append(r.later, laterName{node.Value, s})
+			}
+
+		case *ast.FunctionLiteral:
+			inner := &scope{names: map[string]*binding{}, outer: s}
+			for _, param := range node.Parameters {
+				r.define(inner, param, true)
+			}
+			r.walk(node.Body, inner)
+			return false
+		}
+		return true
+	})
+}
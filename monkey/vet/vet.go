@@ -0,0 +1,102 @@
+/*
+Package vet finds code that runs (or almost does) but probably isn't what
+was meant, the way go vet does for go. every check is a Rule, and they're
+all in Rules:
+
+  - unused: a let in a function that nothing reads
+  - shadow: a let that hides a name from outside its function, or a builtin
+  - unreachable: statements after a return
+  - constant: an if whose condition comes out the same every time
+  - assign: a = in an if's condition, where == was meant
+
+none of them are errors as far as the language goes, so a program with
+findings still runs. the assign rule is the exception: a = in a condition
+doesn't parse at all, and the rule is there to say what the parser's
+error was about
+*/
+package vet
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"sort"
+)
+
+type Diagnostic struct {
+	Rule    string `json:"rule"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", d.Line, d.Column, d.Message, d.Rule)
+}
+
+type Rule struct {
+	Name string // what -name=false on the command line turns off
+	Doc  string // one line about what it finds
+
+	// program is nil when the source didn't parse; only the rules that
+	// look at the tokens can do anything then
+	check func(p *pass)
+}
+
+// Rules are all of the rules, in the order they're documented in
+var Rules = []*Rule{Unused, Shadow, Unreachable, Constant, Assign}
+
+/*
+Source parses src and runs rules on it, returning what they found in the
+order it's in the source. the parser's errors come back on their own: if
+there are any, only the rules that don't need a tree ran
+*/
+func Source(src string, rules []*Rule) ([]Diagnostic, []parser.ParseError) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+
+	ps := &pass{tokens: lexer.Tokenize(src)}
+	if len(p.ParseErrors()) == 0 {
+		ps.program = program
+	}
+
+	for _, r := range rules {
+		ps.rule = r.Name
+		r.check(ps)
+	}
+
+	sort.SliceStable(ps.diagnostics, func(i, j int) bool {
+		a, b := ps.diagnostics[i], ps.diagnostics[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return ps.diagnostics, p.ParseErrors()
+}
+
+// a pass is one run of the rules over a program
+type pass struct {
+	tokens  []token.Token
+	program *ast.Program
+
+	rule        string // the rule that's running, for report
+	diagnostics []Diagnostic
+
+	scopes *resolution // worked out the first time a rule asks for it
+}
+
+func (p *pass) report(tok token.Token, format string, args ...interface{}) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Rule:    p.rule,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (p *pass) resolution() *resolution {
+	if p.scopes == nil {
+		p.scopes = resolve(p.program)
+	}
+	return p.scopes
+}
@@ -0,0 +1,109 @@
+package vet
+
+import (
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     *Rule
+		input    string
+		expected []string
+	}{
+		{Unused, "let f = fn() { let x = 1; x };", nil},
+		{Unused, "let f = fn() { let x = 1; 2 };", []string{"1:20: x is never used (unused)"}},
+		{Unused, "let f = fn() { let _x = 1; 2 };", nil},
+		{Unused, "let x = 1;", nil}, // globals are for whoever loads the file
+		{Unused, "let f = fn(a, b) { let g = fn() { a }; 1 };", []string{"1:24: g is never used (unused)"}},
+		{Unused, "let f = fn() { let g = fn(n) { if (n < 1) { 0 } else { g(n - 1) } }; 1 };", []string{"1:20: g is never used (unused)"}},
+		{Unused, "let f = fn() { let g = fn(n) { if (n < 1) { 0 } else { g(n - 1) } }; g(3) };", nil},
+		{Unused, "let f = fn() { let x = 1; let x = 2; x };", []string{"1:20: x is never used (unused)"}},
+		{Unused, "let f = fn() { let x = 1; let x = x + 1; x };", nil},
+		// defined after the function that uses it, but before it runs
+		{Unused, "let f = fn() { let a = fn() { b() }; let b = fn() { 1 }; a() };", nil},
+
+		{Shadow, "let x = 1; let f = fn() { let x = 2; x };", []string{"1:31: x shadows the x from line 1 (shadow)"}},
+		{Shadow, "let x = 1;\nlet f = fn(x) { x };", nil},
+		{Shadow, "let f = fn(x) { let x = 2; x };", nil},
+		{Shadow, "let x = 1; if (x) { let x = 2; }", nil},
+		{Shadow, "let len = fn(x) { 0 };", []string{"1:5: len shadows the builtin len (shadow)"}},
+		{Shadow, "let f = fn(a) { fn() { let a = 1; a } };", []string{"1:28: a shadows the a from line 1 (shadow)"}},
+
+		{Unreachable, "return 1; puts(2);", []string{"1:11: unreachable code (unreachable)"}},
+		{Unreachable, "let f = fn() { return 1; let x = 2; x };", []string{"1:26: unreachable code (unreachable)"}},
+		{Unreachable, "let f = fn(n) { if (n) { return 1; } n };", nil},
+		{Unreachable, "let f = fn(n) { if (n) { return 1; } else { return 2; } n };", []string{"1:57: unreachable code (unreachable)"}},
+		{Unreachable, "let f = fn(n) { return 1; };", nil},
+
+		{Constant, "if (true) { 1 }", []string{"1:1: condition is always true (constant)"}},
+		{Constant, "if (1 > 2) { 1 }", []string{"1:1: condition is always false (constant)"}},
+		{Constant, "if (!\"\") { 1 }", []string{"1:1: condition is always false (constant)"}},
+		{Constant, "if (0) { 1 }", []string{"1:1: condition is always true (constant)"}},
+		{Constant, "if ([1][5]) { 1 }", nil}, // indexes are left alone
+		{Constant, "if (1 + true) { 1 }", nil},
+		{Constant, "let x = 1; if (x > 2) { 1 }", nil},
+
+		{Assign, "if (x = 1) { 2 }", []string{"1:7: = in a condition, did you mean ==? (assign)"}},
+		{Assign, "if (x == 1) { 2 }", nil},
+		{Assign, "if (fn() { let y = 1; y }()) { 2 }", nil},
+	}
+
+	for _, tt := range tests {
+		diags, _ := Source(tt.input, []*Rule{tt.rule})
+
+		var got []string
+		for _, d := range diags {
+			got = append(got, d.String())
+		}
+
+		if len(got) != len(tt.expected) {
+			t.Errorf("%s: %q - expected %q, got %q", tt.rule.Name, tt.input, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%s: %q - expected %q, got %q", tt.rule.Name, tt.input, tt.expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	input := `let f = fn() {
+	return 1;
+	let unused = 2;
+};
+if (true) { f() }`
+
+	diags, parseErrors := Source(input, Rules)
+	if len(parseErrors) != 0 {
+		t.Fatalf("unexpected parse errors: %v", parseErrors)
+	}
+
+	// in the order they're in the source, whatever rule found them
+	expected := []string{
+		"3:2: unreachable code (unreachable)",
+		"3:6: unused is never used (unused)",
+		"5:1: condition is always true (constant)",
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("expected %d findings, got %d: %v", len(expected), len(diags), diags)
+	}
+	for i, d := range diags {
+		if d.String() != expected[i] {
+			t.Errorf("diags[%d] - expected %q, got %q", i, expected[i], d.String())
+		}
+	}
+}
+
+// when the source doesn't parse, only the rules on the tokens run
+func TestSourceWithParseErrors(t *testing.T) {
+	diags, parseErrors := Source("let x = 1;\nif (x = 2) { 3 }", Rules)
+
+	if len(parseErrors) == 0 {
+		t.Fatalf("expected parse errors")
+	}
+	if len(diags) != 1 || diags[0].Rule != "assign" {
+		t.Errorf("expected only the assign finding, got %v", diags)
+	}
+}
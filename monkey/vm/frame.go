@@ -0,0 +1,26 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+/*
+a frame is one function call that's in progress: the closure, how far
+into its instructions we are, and where on the stack its arguments and
+locals start. the main program runs in a frame of its own too
+*/
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+// ip starts at -1 since the vm increments it before every instruction
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,97 @@
+package vm
+
+import (
+	"monkey/object"
+	"sync"
+)
+
+/*
+a program that calls a lot of functions would otherwise keep the go GC
+busy with things that only live for a moment:
+
+  - frames live in one slice that's allocated with the vm, a call just
+    fills in the next one (see pushFrame)
+  - that slice and the stack are big, and making a vm for every little
+    program (an embedder evaluating snippets does that) would allocate and
+    clear them every time. they go back into a pool once Run is done and
+    the next vm takes them from there
+  - arithmetic mostly deals in small numbers - counters, indexes, n - 1 -
+    so the results between smallIntMin and smallIntMax come from a table
+    that's made once. integers can't be changed and the vm compares them
+    by value, so nobody can tell the difference
+*/
+const (
+	smallIntMin = -128
+	smallIntMax = 1024
+)
+
+var smallInts = func() []*object.Integer {
+	ints := make([]*object.Integer, smallIntMax-smallIntMin+1)
+	for i := range ints {
+		ints[i] = &object.Integer{Value: int64(i + smallIntMin)}
+	}
+	return ints
+}()
+
+func (vm *VM) integer(value int64) *object.Integer {
+	if value >= smallIntMin && value <= smallIntMax {
+		vm.stats.CachedIntegers++
+		return smallInts[value-smallIntMin]
+	}
+
+	vm.stats.Integers++
+	return &object.Integer{Value: value}
+}
+
+// the stack and the frames of a vm that's finished running
+type buffers struct {
+	stack  []object.Object
+	frames []Frame
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &buffers{
+			stack:  make([]object.Object, StackSize),
+			frames: make([]Frame, MaxFrames),
+		}
+	},
+}
+
+// release hands the stack and frames back. they're cleared first, so the
+// pool doesn't keep the values of the last program alive - the frames only
+// as far as they were ever used
+func (vm *VM) release() {
+	if vm.buffers == nil {
+		return
+	}
+
+	clear(vm.stack)
+	clear(vm.frames[:vm.stats.MaxFrameDepth])
+	bufferPool.Put(vm.buffers)
+
+	vm.buffers = nil
+	vm.stack = nil
+	vm.frames = nil
+}
+
+/*
+Stats counts what a run allocated, and what it didn't have to thanks to
+the pooling - it's there to check that the pooling works, e.g. with
+monkey run --engine=vm --stats
+*/
+type Stats struct {
+	Calls         int // closures called, each one in a reused frame
+	MaxFrameDepth int // the most frames in use at once, the main program's included
+
+	Integers       int // integers allocated,
+	CachedIntegers int // and the ones that came out of the small integer table instead
+	Strings        int
+	Arrays         int
+	Hashes         int
+	Closures       int
+}
+
+func (vm *VM) Stats() Stats {
+	return vm.stats
+}
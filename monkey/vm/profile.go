@@ -0,0 +1,38 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+	"monkey/profile"
+)
+
+// SetProfile has Run tell p about every call and return, and count the
+// opcodes it runs there. the counts go to p when Run is done
+func (vm *VM) SetProfile(p *profile.Profile) {
+	vm.profile = p
+	vm.opcodes = new([256]int)
+}
+
+func (vm *VM) enterProfile(cl *object.Closure) {
+	vm.profile.Enter(cl.Fn.Name, cl.Fn.Line)
+}
+
+func (vm *VM) enterBuiltin(builtin *object.Builtin) {
+	name := object.BuiltinName(builtin)
+	if name == "" {
+		name = "builtin"
+	}
+	vm.profile.Enter(name, 0)
+}
+
+func (vm *VM) flushOpcodes() {
+	for op, n := range vm.opcodes {
+		if n == 0 {
+			continue
+		}
+		if def, err := code.Lookup(byte(op)); err == nil {
+			vm.profile.Op(def.Name, n)
+		}
+	}
+	vm.opcodes = new([256]int)
+}
@@ -0,0 +1,727 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"monkey/profile"
+)
+
+const (
+	StackSize   = 2048
+	GlobalsSize = 65536 // OpGetGlobal/OpSetGlobal have a two byte operand
+	MaxFrames   = 1024
+)
+
+// the same singletons the evaluator uses (see object.TRUE)
+var (
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
+)
+
+/*
+the vm runs bytecode on a stack machine: instructions pop their operands
+off the stack and push their result back on. sp always points to the next
+free slot, so the top of the stack is stack[sp-1]
+
+a call pushes a new frame: the function's arguments are already on the
+stack, and its locals get the slots right above them. returning throws all
+of that away again, together with the function itself, and pushes the
+return value in its place. functions are always called as closures, which
+carry the free variables the function uses along with it
+
+it's meant to behave exactly like the evaluator, error messages included
+*/
+type VM struct {
+	constants []object.Object
+	globals   []object.Object
+
+	stack []object.Object
+	sp    int
+
+	frames      []Frame
+	framesIndex int
+
+	// where stack and frames came from, see pool.go
+	buffers *buffers
+
+	lastPopped object.Object
+	stats      Stats
+
+	limits *object.Limits
+
+	// what OpGetBuiltin gets instead of object.Builtins, nil for those
+	builtins []*object.Builtin
+
+	profile *profile.Profile
+	opcodes *[256]int // how often each opcode ran, while profiling
+}
+
+// Error is a runtime error, with the position of the instruction that
+// failed
+type Error struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsState(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsState runs bytecode with globals that are already set up,
+// e.g. by an earlier run or because the caller defined some itself
+func NewWithGlobalsState(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	b := bufferPool.Get().(*buffers)
+	b.frames[0] = *NewFrame(mainClosure, 0)
+
+	return &VM{
+		constants: bytecode.Constants,
+		globals:   s,
+
+		stack: b.stack,
+		sp:    0,
+
+		frames:      b.frames,
+		framesIndex: 1,
+
+		buffers: b,
+		stats:   Stats{MaxFrameDepth: 1},
+	}
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return &vm.frames[vm.framesIndex-1]
+}
+
+// the frames are all allocated up front, a call only fills in the next one
+func (vm *VM) pushFrame(cl *object.Closure, basePointer int) error {
+	if vm.framesIndex >= MaxFrames {
+		return errStackOverflow
+	}
+
+	frame := &vm.frames[vm.framesIndex]
+	frame.cl = cl
+	frame.ip = -1
+	frame.basePointer = basePointer
+
+	vm.framesIndex++
+	if vm.framesIndex > vm.stats.MaxFrameDepth {
+		vm.stats.MaxFrameDepth = vm.framesIndex
+	}
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return &vm.frames[vm.framesIndex]
+}
+
+// SetLimits has Run check l for every call and instruction
+func (vm *VM) SetLimits(l *object.Limits) {
+	vm.limits = l
+}
+
+// SetBuiltin has the program call b wherever it calls the builtin called
+// name - a puts that writes somewhere other than os.Stdout, say. a name
+// that isn't one of object.Builtins changes nothing
+func (vm *VM) SetBuiltin(name string, b *object.Builtin) {
+	for i, def := range object.Builtins {
+		if def.Name != name {
+			continue
+		}
+		if vm.builtins == nil {
+			vm.builtins = make([]*object.Builtin, len(object.Builtins))
+			for j, def := range object.Builtins {
+				vm.builtins[j] = def.Builtin
+			}
+		}
+		vm.builtins[i] = b
+	}
+}
+
+// LastPoppedStackElem is the value of the last expression statement,
+// which makes it the value of the whole program
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+// Run runs the program to its end (or its first error). a vm only runs
+// once: after that its stack goes back into the pool, and all that's left
+// is the value of the program and the globals
+func (vm *VM) Run() error {
+	if vm.buffers == nil {
+		return nil
+	}
+
+	err := vm.run()
+	if vm.profile != nil {
+		vm.flushOpcodes()
+	}
+
+	// after a stack overflow there's nothing past the top
+	if vm.sp < len(vm.stack) {
+		vm.lastPopped = vm.stack[vm.sp]
+	}
+	vm.release()
+
+	return err
+}
+
+/*
+run is the loop everything else hangs off, so it's written to do as little
+as possible per instruction:
+  - the current frame's instructions and ip are kept in locals instead of
+    going through currentFrame() for every byte. ip goes back into the
+    frame whenever something else is going to look at it - a call (the
+    frame has to know where to carry on), a return, or an error
+  - operands are put together from the bytes where they are (see read16)
+    instead of slicing ins for every one of them
+  - frames are reused, so a call doesn't allocate one
+*/
+func (vm *VM) run() error {
+	frame := vm.currentFrame()
+	ins := frame.Instructions()
+	ip := frame.ip
+
+	var err error
+
+	for ip < len(ins)-1 {
+		ip++
+		op := code.Opcode(ins[ip])
+
+		if vm.limits != nil {
+			if err = vm.limits.Step(); err != nil {
+				frame.ip = ip
+				return vm.positioned(err, ip)
+			}
+		}
+		if vm.opcodes != nil {
+			vm.opcodes[op]++
+		}
+
+		switch op {
+		case code.OpConstant:
+			constIndex := read16(ins, ip+1)
+			ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.sp--
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			err = vm.executeBinaryOperation(op)
+
+		case code.OpTrue:
+			err = vm.push(True)
+		case code.OpFalse:
+			err = vm.push(False)
+		case code.OpNull:
+			err = vm.push(Null)
+
+		case code.OpBang:
+			err = vm.executeBangOperator()
+		case code.OpMinus:
+			err = vm.executeMinusOperator()
+
+		case code.OpJump:
+			ip = read16(ins, ip+1) - 1
+
+		case code.OpJumpNotTruthy:
+			pos := read16(ins, ip+1)
+			ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := read16(ins, ip+1)
+			ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		// a global whose let was skipped - it's in a branch that didn't run -
+		// has no value yet, and it's null until it gets one
+		case code.OpGetGlobal:
+			globalIndex := read16(ins, ip+1)
+			ip += 2
+			if global := vm.globals[globalIndex]; global != nil {
+				err = vm.push(global)
+			} else {
+				err = vm.push(Null)
+			}
+
+		case code.OpSetLocal:
+			localIndex := int(ins[ip+1])
+			ip += 1
+			vm.stack[frame.basePointer+localIndex] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := int(ins[ip+1])
+			ip += 1
+			err = vm.push(vm.stack[frame.basePointer+localIndex])
+
+		case code.OpGetBuiltin:
+			builtinIndex := int(ins[ip+1])
+			ip += 1
+			if vm.builtins != nil {
+				err = vm.push(vm.builtins[builtinIndex])
+			} else {
+				err = vm.push(object.Builtins[builtinIndex].Builtin)
+			}
+
+		case code.OpArray:
+			numElements := read16(ins, ip+1)
+			ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(array)
+
+		case code.OpHash:
+			numElements := read16(ins, ip+1)
+			ip += 2
+
+			var hash object.Object
+			hash, err = vm.buildHash(vm.sp-numElements, vm.sp)
+			if err == nil {
+				vm.sp = vm.sp - numElements
+				err = vm.push(hash)
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.executeIndexExpression(left, index)
+
+		// the call might push a frame, and then that's where we carry on
+		case code.OpCall:
+			numArgs := int(ins[ip+1])
+			ip += 1
+
+			frame.ip = ip
+			if err = vm.executeCall(numArgs); err == nil {
+				frame = vm.currentFrame()
+				ins = frame.Instructions()
+				ip = frame.ip
+			}
+
+		case code.OpClosure:
+			constIndex := read16(ins, ip+1)
+			numFree := int(ins[ip+3])
+			ip += 3
+			err = vm.pushClosure(constIndex, numFree)
+
+		case code.OpGetFree:
+			freeIndex := int(ins[ip+1])
+			ip += 1
+			err = vm.push(frame.cl.Free[freeIndex])
+
+		case code.OpCurrentClosure:
+			err = vm.push(frame.cl)
+
+		/*
+			a return in the main program (they're allowed there, like in the
+			evaluator) ends it. the value was just popped, so it's where
+			LastPoppedStackElem looks
+		*/
+		case code.OpReturnValue, code.OpReturn:
+			var returnValue object.Object = Null
+			if op == code.OpReturnValue {
+				returnValue = vm.pop()
+			}
+
+			if vm.framesIndex == 1 {
+				frame.ip = ip
+				return nil
+			}
+
+			vm.sp = vm.popFrame().basePointer - 1
+			if vm.limits != nil {
+				vm.limits.Leave()
+			}
+			if vm.profile != nil {
+				vm.profile.Leave()
+			}
+
+			frame = vm.currentFrame()
+			ins = frame.Instructions()
+			ip = frame.ip
+
+			err = vm.push(returnValue)
+		}
+
+		if err != nil {
+			frame.ip = ip
+			return vm.positioned(err, ip)
+		}
+	}
+
+	frame.ip = ip
+	return nil
+}
+
+// read16 is code.ReadUint16 without making a slice to read from
+func read16(ins code.Instructions, i int) int {
+	return int(ins[i])<<8 | int(ins[i+1])
+}
+
+/*
+positioned turns err into an *Error with the position of the instruction
+at ip in the current frame. only instructions that can fail on their own
+have positions; what's left is running out of stack on e.g. an
+OpConstant, and for that the call that got us into this frame (or the one
+that got us into the caller, and so on) is the place to point at
+*/
+func (vm *VM) positioned(err error, ip int) error {
+	line, column := vm.currentFrame().cl.Fn.Positions.Lookup(ip)
+
+	for i := vm.framesIndex - 2; line == 0 && i >= 0; i-- {
+		line, column = vm.frames[i].cl.Fn.Positions.Lookup(vm.frames[i].ip)
+	}
+
+	return &Error{Message: err.Error(), Line: line, Column: column}
+}
+
+// made once up front, so push stays small enough to be inlined
+var errStackOverflow = errors.New("stack overflow")
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return errStackOverflow
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// the text of each operator, for error messages
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+// the same rules as the evaluator's evalInfixExpression. two integers are
+// by far the most common case, so they're checked for first and without
+// going through Type()
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if leftInt, ok := left.(*object.Integer); ok {
+		if rightInt, ok := right.(*object.Integer); ok {
+			return vm.executeBinaryIntegerOperation(op, leftInt, rightInt)
+		}
+	}
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	case leftType != rightType:
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operators[op], rightType)
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", leftType, operators[op], rightType)
+	}
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right *object.Integer) error {
+	leftValue := left.Value
+	rightValue := right.Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(vm.integer(leftValue + rightValue))
+	case code.OpSub:
+		return vm.push(vm.integer(leftValue - rightValue))
+	case code.OpMul:
+		return vm.push(vm.integer(leftValue * rightValue))
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero: %d / %d", leftValue, rightValue)
+		}
+		return vm.push(vm.integer(leftValue / rightValue))
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		vm.stats.Strings++
+		result := &object.String{Value: leftValue + rightValue}
+		if vm.limits != nil {
+			if err := vm.limits.Length(result); err != nil {
+				return err
+			}
+		}
+		return vm.push(result)
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	if operand.Type() != object.INTEGER_OBJ {
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+
+	value := operand.(*object.Integer).Value
+	return vm.push(vm.integer(-value))
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	vm.stats.Arrays++
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		pair := object.HashPair{Key: key, Value: value}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = pair
+	}
+
+	vm.stats.Hashes++
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+// out of bounds access gives null rather than an error
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if i < 0 || i > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.Elements[i])
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+// the function being called sits right below its arguments
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn := cl.Fn
+	if numArgs != fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			fn.NumParameters, numArgs)
+	}
+
+	if vm.limits != nil {
+		if err := vm.limits.Enter(); err != nil {
+			return err
+		}
+	}
+
+	basePointer := vm.sp - numArgs
+	if basePointer+fn.NumLocals >= StackSize {
+		return errStackOverflow
+	}
+	if err := vm.pushFrame(cl, basePointer); err != nil {
+		return err
+	}
+
+	// the locals past the arguments hold whatever the last call this deep
+	// left there, and a let in a branch that didn't run never sets its
+	// slot - so they start out as Null, like a global nothing set
+	for i := basePointer + fn.NumParameters; i < basePointer+fn.NumLocals; i++ {
+		vm.stack[i] = Null
+	}
+	vm.sp = basePointer + fn.NumLocals
+	vm.stats.Calls++
+	if vm.profile != nil {
+		vm.enterProfile(cl)
+	}
+
+	return nil
+}
+
+// the free variables were pushed right before the OpClosure, they move off
+// the stack and into the closure
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	// most functions don't use any, and then there's nothing to allocate
+	var free []object.Object
+	if numFree > 0 {
+		free = make([]object.Object, numFree)
+		copy(free, vm.stack[vm.sp-numFree:vm.sp])
+		vm.sp = vm.sp - numFree
+	}
+
+	vm.stats.Closures++
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+// an error a builtin returns stops the program, just like it does in the
+// evaluator
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	if vm.profile != nil {
+		vm.enterBuiltin(builtin)
+		defer vm.profile.Leave()
+	}
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+	if vm.limits != nil {
+		if err := vm.limits.Length(result); err != nil {
+			return err
+		}
+	}
+
+	if result != nil {
+		return vm.push(result)
+	}
+	return vm.push(Null)
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
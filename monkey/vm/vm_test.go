@@ -0,0 +1,716 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/profile"
+	"strings"
+	"testing"
+	"time"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"2", 2},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"1 * 2", 2},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == true", true},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{"!true", false},
+		{"!5", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let x = 1; }", Null},
+		{"if (true) { }", Null},
+		{`if ("") { 10 }`, 10},
+		{"if (if (1 < 2) { true } else { false }) { 10 } else { 20 }", 10},
+		{"if (if (1 > 2) { true } else { false }) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { if (2 < 1) { 10 } else { 20 } } else { 30 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"if (false) { let y = 2; }; y", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"{}", map[object.HashKey]int64{}},
+		{
+			"{1: 2, 2: 3}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 2,
+				(&object.Integer{Value: 2}).HashKey(): 3,
+			},
+		},
+		{
+			"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 2}).HashKey(): 4,
+				(&object.Integer{Value: 6}).HashKey(): 16,
+			},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; b()", 2},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+		{"let one = fn() { let one = 1; one }; one();", 1},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let globalNum = 10; let sum = fn(a, b) { let c = a + b; c + globalNum; }; sum(1, 2);", 13},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)", 120},
+		{"return 5; 10", 5},
+		{"let pick = fn(x) { if (x) { return 1; } else { return 2; } 3 }; pick(false)", 2},
+		// a local whose let didn't run, on a fresh stack and on one an
+		// earlier call left its arguments on
+		{"let f = fn() { if (false) { let y = 1; }; y }; f()", Null},
+		{"let g = fn(a, b, c) { a + b + c }; g(1, 2, 3); let f = fn() { if (false) { let y = 1; }; y }; f()", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+// the most locals and arguments a function can have, each of them still
+// the one it's meant to be
+func TestLocalAndArgumentLimits(t *testing.T) {
+	// identifiers can't have digits in them
+	name := func(i int) string {
+		return "x" + string(rune('a'+i/26/26)) + string(rune('a'+i/26%26)) + string(rune('a'+i%26))
+	}
+
+	var lets, params, args strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&lets, "let %s = %d; ", name(i), i+1)
+	}
+	for i := 0; i < 255; i++ {
+		if i > 0 {
+			params.WriteString(", ")
+			args.WriteString(", ")
+		}
+		params.WriteString(name(i))
+		fmt.Fprint(&args, i+1)
+	}
+
+	runVmTests(t, []vmTestCase{
+		{"fn() { " + lets.String() + name(0) + " }()", 1},
+		{"fn() { " + lets.String() + name(255) + " }()", 256},
+		{"fn(" + params.String() + ") { " + name(0) + " }(" + args.String() + ")", 1},
+		{"fn(" + params.String() + ") { " + name(254) + " }(" + args.String() + ")", 255},
+	})
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();", 99},
+		{"let newAdder = fn(a, b) { fn(c) { a + b + c }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{"let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{`
+		let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) {
+				let e = d + c;
+				fn(f) { e + f; };
+			};
+		};
+		let newAdderInner = newAdderOuter(1, 2)
+		let adder = newAdderInner(3);
+		adder(8);
+		`, 14},
+		{`
+		let newClosure = fn(a, b) {
+			let one = fn() { a; };
+			let two = fn() { b; };
+			fn() { one() + two(); };
+		};
+		let closure = newClosure(9, 90);
+		closure();
+		`, 99},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+		let countDown = fn(x) {
+			if (x == 0) { return 0; } else { countDown(x - 1); }
+		};
+		let wrapper = fn() { countDown(1); };
+		wrapper();
+		`, 0},
+		{`
+		let wrapper = fn() {
+			let countDown = fn(x) {
+				if (x == 0) { return 0; } else { countDown(x - 1); }
+			};
+			countDown(1);
+		};
+		wrapper();
+		`, 0},
+		{`
+		let fibonacci = fn(x) {
+			if (x == 0) { return 0; }
+			if (x == 1) { return 1; }
+			fibonacci(x - 1) + fibonacci(x - 2);
+		};
+		fibonacci(15);
+		`, 610},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`let len = fn(x) { 42 }; len([])`, 42},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"5 + true", "type mismatch: INTEGER + BOOLEAN", 1, 3},
+		{"5 < true", "type mismatch: INTEGER < BOOLEAN", 1, 3},
+		{"-true", "unknown operator: -BOOLEAN", 1, 1},
+		{"true + false", "unknown operator: BOOLEAN + BOOLEAN", 1, 6},
+		{`"a" - "b"`, "unknown operator: STRING - STRING", 1, 5},
+		{"let x = 1;\nx / 0", "division by zero: 1 / 0", 2, 3},
+		{"5[0]", "index operator not supported: INTEGER", 1, 2},
+		{"{fn(x) { x }: 1}", "unusable as hash key: CLOSURE", 1, 1},
+		{"1()", "not a function: INTEGER", 1, 2},
+		{"fn(a) { a }()", "wrong number of arguments: want=1, got=0", 1, 12},
+		{`len(1)`, "argument to `len` not supported, got INTEGER", 1, 4},
+		{"let f = fn() {\n  1 + true\n}; f()", "type mismatch: INTEGER + BOOLEAN", 2, 5},
+		{"let f = fn(n) { f(n + 1) }; f(0)", "stack overflow", 1, 18},
+		{"if (true) { 1 } else { 2 }; 1 + true", "type mismatch: INTEGER + BOOLEAN", 1, 31},
+		{"let f = fn() { if (false) { let y = 1; }; y + 1 }; f()", "type mismatch: NULL + INTEGER", 1, 45},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+
+		vmErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("%q: expected a runtime error, got=%v", tt.input, err)
+		}
+
+		if vmErr.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong message. want=%q, got=%q", tt.input, tt.expectedMessage, vmErr.Message)
+		}
+
+		if vmErr.Line != tt.expectedLine || vmErr.Column != tt.expectedColumn {
+			t.Errorf("%q: wrong position. want=%d:%d, got=%d:%d", tt.input,
+				tt.expectedLine, tt.expectedColumn, vmErr.Line, vmErr.Column)
+		}
+	}
+}
+
+// the vm should be a drop-in replacement for the evaluator, so the same
+// programs have to give the same results and the same errors
+func TestSameAsEvaluator(t *testing.T) {
+	inputs := []string{
+		`let map = fn(arr, f) { if (len(arr) == 0) { [] } else { let h = f(first(arr)); push(map(rest(arr), f), h) } }; map([1, 2, 3], fn(x) { x * 2 })`,
+		`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`,
+		`let h = {"a": 1, true: [1, "two"]}; [h["a"], h[true][1], h["missing"]]`,
+		`if (false) { 1 }`,
+		`"abc" == "abc"`,
+		`[1] == [1]`,
+		`1 + "a"`,
+		`-"a"`,
+		`[1, 2][true]`,
+		`{[1]: 2}`,
+		`rest([])`,
+		`let compose = fn(f, g) { fn(x) { g(f(x)) } }; compose(fn(x) { x + 1 }, fn(x) { x * 2 })(5)`,
+		`let counter = fn(n) { fn() { n } }; [counter(1)(), counter(2)()]`,
+	}
+
+	for _, input := range inputs {
+		program := parse(input)
+
+		expected := evaluator.Eval(program, object.NewEnvironment())
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("%q: compiler error: %s", input, err)
+		}
+
+		vm := New(comp.Bytecode())
+		var got string
+		if err := vm.Run(); err != nil {
+			got = "ERROR: " + err.Error()
+		} else {
+			got = vm.LastPoppedStackElem().Inspect()
+		}
+
+		if got != expected.Inspect() {
+			t.Errorf("%q: vm and evaluator disagree.\nevaluator=%q\nvm=       %q", input, expected.Inspect(), got)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Stats
+	}{
+		{"1 + 2", Stats{MaxFrameDepth: 1, CachedIntegers: 1}},
+		{"5000 * 2; -1; -5000", Stats{MaxFrameDepth: 1, Integers: 2, CachedIntegers: 1}},
+		{`"a" + "b"; [1, 2]; {1: 2}`, Stats{MaxFrameDepth: 1, Strings: 1, Arrays: 1, Hashes: 1}},
+		{
+			"let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(10)",
+			Stats{Calls: 11, MaxFrameDepth: 12, CachedIntegers: 20, Closures: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", tt.input, err)
+		}
+
+		if vm.Stats() != tt.expected {
+			t.Errorf("%q: wrong stats.\nwant=%+v\ngot= %+v", tt.input, tt.expected, vm.Stats())
+		}
+	}
+}
+
+// the stack and frames get reused by the next vm, which mustn't see
+// anything of the one before
+func TestPooledBuffers(t *testing.T) {
+	inputs := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(a, b) { let c = a + b; c }; f(1, 2)", 3},
+		{"let f = fn(x) { f(x + 1) }; f(0)", "stack overflow"},
+		{"let g = fn(a, b) { [a, b] }; len(g(1, 2))", 2},
+		{"1 + 1", 2},
+	}
+
+	for _, tt := range inputs {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if err == nil || err.Error() != expected {
+				t.Errorf("%q: want error %q, got=%v", tt.input, expected, err)
+			}
+			continue
+		case int:
+			if err != nil {
+				t.Fatalf("%q: vm error: %s", tt.input, err)
+			}
+			testExpectedObject(t, tt.input, expected, vm.LastPoppedStackElem())
+		}
+
+		// running it again doesn't do anything, the result stays
+		if err := vm.Run(); err != nil {
+			t.Errorf("%q: second run failed: %s", tt.input, err)
+		}
+	}
+}
+
+/*
+the benchmarks compile once and then only time the vm. they're what the
+dispatch loop gets measured with:
+
+	go test ./vm -run NONE -bench . -benchmem
+*/
+var benchmarks = []struct {
+	name     string
+	input    string
+	expected int
+}{
+	{"fib", `
+	let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+	fib(20)`, 6765},
+
+	// there are no loops, so a loop is a function calling itself - kept
+	// under MaxFrames deep, and run a few times
+	{"loop-sum", `
+	let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } };
+	let times = fn(n) { if (n == 0) { 0 } else { sum(300, 0) + times(n - 1) } };
+	times(40)`, 40 * 45150},
+
+	{"map-filter", `
+	let range = fn(n, acc) { if (n == 0) { acc } else { range(n - 1, push(acc, n)) } };
+	let map = fn(arr, f) { if (len(arr) == 0) { [] } else { let h = f(first(arr)); push(map(rest(arr), f), h) } };
+	let filter = fn(arr, f) { if (len(arr) == 0) { [] } else { let kept = filter(rest(arr), f); if (f(first(arr))) { push(kept, first(arr)) } else { kept } } };
+	let reduce = fn(arr, acc, f) { if (len(arr) == 0) { acc } else { reduce(rest(arr), f(acc, first(arr)), f) } };
+	let numbers = range(300, []);
+	let evens = filter(map(numbers, fn(x) { x * 3 }), fn(x) { x / 2 * 2 == x });
+	reduce(evens, 0, fn(a, b) { a + b })`, 67950},
+}
+
+func BenchmarkVM(b *testing.B) {
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			comp := compiler.New()
+			if err := comp.Compile(parse(bm.input)); err != nil {
+				b.Fatalf("compiler error: %s", err)
+			}
+			bytecode := comp.Bytecode()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				vm := New(bytecode)
+				if err := vm.Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+
+				if err := testIntegerObject(int64(bm.expected), vm.LastPoppedStackElem()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+
+		testExpectedObject(t, tt.input, tt.expected, stackElem)
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		if err := testIntegerObject(int64(expected), actual); err != nil {
+			t.Errorf("%q: testIntegerObject failed: %s", input, err)
+		}
+
+	case bool:
+		if err := testBooleanObject(expected, actual); err != nil {
+			t.Errorf("%q: testBooleanObject failed: %s", input, err)
+		}
+
+	case string:
+		if err := testStringObject(expected, actual); err != nil {
+			t.Errorf("%q: testStringObject failed: %s", input, err)
+		}
+
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%q: object is not Null: %T (%+v)", input, actual, actual)
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("%q: object not Array: %T (%+v)", input, actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("%q: wrong num of elements. want=%d, got=%d",
+				input, len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			if err := testIntegerObject(int64(expectedElem), array.Elements[i]); err != nil {
+				t.Errorf("%q: testIntegerObject failed: %s", input, err)
+			}
+		}
+
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("%q: object is not Hash. got=%T (%+v)", input, actual, actual)
+			return
+		}
+
+		if len(hash.Pairs) != len(expected) {
+			t.Errorf("%q: hash has wrong number of Pairs. want=%d, got=%d",
+				input, len(expected), len(hash.Pairs))
+			return
+		}
+
+		for expectedKey, expectedValue := range expected {
+			pair, ok := hash.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("%q: no pair for given key in Pairs", input)
+			}
+
+			if err := testIntegerObject(expectedValue, pair.Value); err != nil {
+				t.Errorf("%q: testIntegerObject failed: %s", input, err)
+			}
+		}
+	}
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+	}
+
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+
+	return nil
+}
+
+func TestProfile(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } };
+sum(3);
+fn() { len("ab") }();`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	p := profile.New()
+	vm := New(comp.Bytecode())
+	vm.SetProfile(p)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	p.Stop()
+
+	// the same as the evaluator's, see its TestProfile
+	expected := []string{"main 0 1", "sum 1 4", "fn 3 1", "len 0 1"}
+	var got []string
+	for _, fn := range p.Functions {
+		got = append(got, fmt.Sprintf("%s %d %d", fn.Name, fn.Line, fn.Calls))
+	}
+	if strings.Join(got, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("wrong functions. expected=%q, got=%q", expected, got)
+	}
+
+	if p.Opcodes["OpCall"] != 6 || p.Opcodes["OpReturnValue"] != 5 {
+		t.Errorf("wrong opcode counts. got=%v", p.Opcodes)
+	}
+}
+
+/*
+FuzzDecode runs whatever Decode lets through, which is everything a .mkyc
+file can make the vm do. Decode has to turn away anything that would have
+the vm panic, and what it does take has to run to an end or an error -
+under limits, since a jump backwards is a loop
+
+	go test ./vm -fuzz FuzzDecode
+*/
+func FuzzDecode(f *testing.F) {
+	for _, seed := range []string{
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)",
+		`let m = {"a": [1, 2, 3]}; m["a"][1] * -len("abc")`,
+		"let x = fn(a) { fn(b) { a - b } }; x(1)(2)",
+		`if (true) { puts("yes") } else { !false }`,
+		// reads a local nothing set, after a call left a value in its slot
+		"let g = fn(a, b, c) { a + b + c }; g(1, 2, 3); let f = fn() { if (false) { let y = 1; }; y + 1 }; f()",
+	} {
+		comp := compiler.New()
+		if err := comp.Compile(parse(seed)); err != nil {
+			f.Fatalf("%q: compiler error: %s", seed, err)
+		}
+		var buf bytes.Buffer
+		if err := compiler.Encode(&buf, comp.Bytecode()); err != nil {
+			f.Fatalf("%q: encode error: %s", seed, err)
+		}
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bytecode, err := compiler.Decode(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		vm := New(bytecode)
+		vm.SetLimits(&object.Limits{MaxDepth: 100, MaxLength: 1 << 16, Deadline: time.Now().Add(time.Second)})
+
+		start := time.Now()
+		vm.Run()
+		if took := time.Since(start); took > 5*time.Second {
+			t.Fatalf("%x took %s", data, took)
+		}
+	})
+}